@@ -0,0 +1,348 @@
+package compress
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jiandahao/goutils/files"
+)
+
+// ArchiveFormat represents an archive format.
+type ArchiveFormat int
+
+const (
+	// FormatTar is the tar format.
+	FormatTar ArchiveFormat = iota
+	// FormatTarGz is the gzip compressed tar format.
+	FormatTarGz
+	// FormatZip is the zip format.
+	FormatZip
+)
+
+// ErrIllegalPath is returned by Extract when an entry would be extracted outside
+// the destination directory, for example an entry named "../../etc/passwd".
+var ErrIllegalPath = errors.New("compress: illegal file path in archive")
+
+// ArchiveDir archives the files under dir that are selected by filter into w, filter
+// is applied to file names as files.GetAllFiles does, nil filter selects all files.
+// Files are stored with paths relative to dir, and their modes and modification
+// times are preserved.
+func ArchiveDir(dir string, filter files.Filter, w io.Writer, format ArchiveFormat) error {
+	paths, err := files.GetAllFiles(filepath.Clean(dir), filter)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case FormatTar:
+		return archiveTar(dir, paths, w)
+	case FormatTarGz:
+		gw, err := NewWriter(w, WithCodec(Gzip))
+		if err != nil {
+			return err
+		}
+
+		if err := archiveTar(dir, paths, gw); err != nil {
+			gw.Close()
+			return err
+		}
+		return gw.Close()
+	case FormatZip:
+		return archiveZip(dir, paths, w)
+	default:
+		return fmt.Errorf("compress: unknown archive format %d", format)
+	}
+}
+
+func archiveTar(dir string, paths []string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, path := range paths {
+		err := addArchiveFile(dir, path, func(name string, info os.FileInfo) (io.Writer, error) {
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return nil, err
+			}
+			header.Name = name
+
+			if err := tw.WriteHeader(header); err != nil {
+				return nil, err
+			}
+			return tw, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func archiveZip(dir string, paths []string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for _, path := range paths {
+		err := addArchiveFile(dir, path, func(name string, info os.FileInfo) (io.Writer, error) {
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return nil, err
+			}
+			header.Name = name
+			header.Method = zip.Deflate
+
+			return zw.CreateHeader(header)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// addArchiveFile writes the content of file path into the writer returned by create.
+func addArchiveFile(dir string, path string, create func(name string, info os.FileInfo) (io.Writer, error)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	name, err := filepath.Rel(dir, path)
+	if err != nil {
+		return err
+	}
+
+	w, err := create(filepath.ToSlash(name), info)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// Extract extracts the archive read from r into destDir, the archive format is detected
+// automatically. Modes and modification times of files are restored. Only regular
+// files and directories are extracted, other entries such as symbolic links are skipped.
+//
+// It returns ErrIllegalPath if an entry would be extracted outside destDir.
+func Extract(r io.Reader, destDir string) error {
+	br := bufio.NewReaderSize(r, 512)
+	header, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return extractZip(br, destDir)
+	case Gzip.(Sniffer).Sniff(header):
+		gr, err := NewReader(br, WithCodec(Gzip))
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+
+		return extractTar(gr, destDir)
+	case isTarHeader(header):
+		return extractTar(br, destDir)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+// isTarHeader reports whether block is a tar header, by the "ustar" magic of the
+// POSIX formats, or by the checksum of the old (v7) format without magic.
+func isTarHeader(block []byte) bool {
+	if len(block) < 512 {
+		return false
+	}
+
+	if string(block[257:262]) == "ustar" {
+		return true
+	}
+
+	field := strings.Trim(string(block[148:156]), " \x00")
+	checksum, err := strconv.ParseInt(field, 8, 64)
+	if err != nil {
+		return false
+	}
+
+	// the checksum is computed with the checksum field filled with spaces, some old
+	// implementations summed signed bytes.
+	var unsigned, signed int64
+	for i, b := range block[:512] {
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		unsigned += int64(b)
+		signed += int64(int8(b))
+	}
+
+	return checksum == unsigned || checksum == signed
+}
+
+// dirModTime is the modification time of an extracted directory.
+type dirModTime struct {
+	path    string
+	modTime time.Time
+}
+
+// restoreDirModTimes sets the modification times of directories, which is done after
+// all the files are extracted, since creating files in a directory changes its
+// modification time.
+func restoreDirModTimes(dirs []dirModTime) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTar(r io.Reader, destDir string) error {
+	var dirs []dirModTime
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return restoreDirModTimes(dirs)
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+
+		err = extractFile(destDir, header.Name, header.FileInfo().Mode(), header.ModTime, tr, &dirs)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(r io.Reader, destDir string) error {
+	// zip reader needs random access, buffer the archive into a temporary file.
+	tmp, err := ioutil.TempFile("", "compress-*.zip")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+
+	var dirs []dirModTime
+	for _, f := range zr.File {
+		mode := f.Mode()
+		if !mode.IsRegular() && !mode.IsDir() {
+			continue
+		}
+
+		err := func() error {
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+
+			return extractFile(destDir, f.Name, mode, f.Modified, rc, &dirs)
+		}()
+		if err != nil {
+			return err
+		}
+	}
+
+	return restoreDirModTimes(dirs)
+}
+
+// extractFile writes the content read from r into file destDir/name. The modification
+// times of directories are appended to dirs to be restored later.
+func extractFile(destDir string, name string, mode os.FileMode, modTime time.Time, r io.Reader, dirs *[]dirModTime) error {
+	path, err := securePath(destDir, name)
+	if err != nil {
+		return err
+	}
+
+	if mode.IsDir() {
+		if err := os.MkdirAll(path, mode.Perm()|0700); err != nil {
+			return err
+		}
+		*dirs = append(*dirs, dirModTime{path: path, modTime: modTime})
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	// the mode passed to OpenFile is affected by umask
+	if err := os.Chmod(path, mode.Perm()); err != nil {
+		return err
+	}
+
+	return os.Chtimes(path, modTime, modTime)
+}
+
+// securePath joins destDir and name, and makes sure the result is inside destDir.
+func securePath(destDir string, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return "", ErrIllegalPath
+	}
+
+	destDir = filepath.Clean(destDir)
+	path := filepath.Join(destDir, filepath.FromSlash(name))
+
+	rel, err := filepath.Rel(destDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", ErrIllegalPath
+	}
+
+	return path, nil
+}
@@ -0,0 +1,136 @@
+package compress
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveDir(t *testing.T) {
+	src := t.TempDir()
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	testFiles := map[string]os.FileMode{
+		"a.txt":           0644,
+		"b.log":           0600,
+		"sub/c.txt":       0755,
+		"sub/deep/d.txt":  0640,
+		"sub/deep/e.skip": 0644,
+	}
+
+	for name, mode := range testFiles {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(name), mode); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(path, mode)
+		os.Chtimes(path, modTime, modTime)
+	}
+
+	filter := func(name string) bool {
+		return !strings.HasSuffix(name, ".skip")
+	}
+
+	for _, format := range []ArchiveFormat{FormatTar, FormatTarGz, FormatZip} {
+		var archive bytes.Buffer
+		if err := ArchiveDir(src, filter, &archive, format); err != nil {
+			t.Fatalf("format %d: %v", format, err)
+		}
+
+		dest := t.TempDir()
+		if err := Extract(&archive, dest); err != nil {
+			t.Fatalf("format %d: %v", format, err)
+		}
+
+		for name, mode := range testFiles {
+			path := filepath.Join(dest, filepath.FromSlash(name))
+			info, err := os.Stat(path)
+			if strings.HasSuffix(name, ".skip") {
+				if err == nil {
+					t.Fatalf("format %d: %s should be filtered", format, name)
+				}
+				continue
+			}
+
+			if err != nil {
+				t.Fatalf("format %d: %v", format, err)
+			}
+
+			if info.Mode().Perm() != mode {
+				t.Fatalf("format %d: wanted mode %v of %s but got %v", format, mode, name, info.Mode().Perm())
+			}
+
+			if !info.ModTime().Equal(modTime) {
+				t.Fatalf("format %d: wanted modification time %v of %s but got %v", format, modTime, name, info.ModTime())
+			}
+
+			data, _ := ioutil.ReadFile(path)
+			if string(data) != name {
+				t.Fatalf("format %d: content of %s mismatch", format, name)
+			}
+		}
+	}
+}
+
+func TestExtract_ZipSlip(t *testing.T) {
+	for _, name := range []string{"../evil.txt", "sub/../../evil.txt", "/tmp/evil.txt"} {
+		var archive bytes.Buffer
+		tw := tar.NewWriter(&archive)
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: 4, Typeflag: tar.TypeReg})
+		tw.Write([]byte("evil"))
+		tw.Close()
+
+		dest := filepath.Join(t.TempDir(), "dest")
+		if err := Extract(&archive, dest); err != ErrIllegalPath {
+			t.Fatalf("entry %s should be rejected, but got error %v", name, err)
+		}
+	}
+}
+
+func TestExtract_Tar(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	tw.WriteHeader(&tar.Header{Name: "dir/", Mode: 0755, Typeflag: tar.TypeDir, ModTime: modTime, Format: tar.FormatUSTAR})
+	tw.WriteHeader(&tar.Header{Name: "dir/a.txt", Mode: 0644, Size: 1, Typeflag: tar.TypeReg, ModTime: modTime, Format: tar.FormatUSTAR})
+	tw.Write([]byte("a"))
+	tw.Close()
+
+	// converts the headers to the old (v7) format without magic
+	v7 := append([]byte(nil), archive.Bytes()...)
+	for _, offset := range []int{0, 512} {
+		block := v7[offset : offset+512]
+		for i := 257; i < 512; i++ {
+			block[i] = 0
+		}
+		copy(block[148:156], "        ")
+		var sum int
+		for _, b := range block {
+			sum += int(b)
+		}
+		copy(block[148:156], fmt.Sprintf("%06o\x00 ", sum))
+	}
+
+	for name, data := range map[string][]byte{"ustar": archive.Bytes(), "v7": v7} {
+		dest := t.TempDir()
+		if err := Extract(bytes.NewReader(data), dest); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		info, err := os.Stat(filepath.Join(dest, "dir"))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if !info.ModTime().Equal(modTime) {
+			t.Fatalf("%s: wanted modification time %v of directory but got %v", name, modTime, info.ModTime())
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+var (
+	// ErrUnknownFormat is returned when the compression format of data could not be detected.
+	ErrUnknownFormat = errors.New("compress: unknown compression format")
+	// ErrNotSupported is returned when a codec doesn't support compressing or decompressing.
+	ErrNotSupported = errors.New("compress: operation not supported by codec")
+)
+
+// Codec represents a compression format.
+type Codec interface {
+	// Name returns the codec name, such as "gzip".
+	Name() string
+	// NewWriter returns a writer that compresses the data written to it into w.
+	// Callers must close the writer to flush the pending data.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader that decompresses the data read from r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Sniffer is implemented by codecs whose format could be detected by magic bytes.
+type Sniffer interface {
+	// Sniff reports whether header, the leading bytes of data, is in the codec's format.
+	Sniff(header []byte) bool
+}
+
+// sniffLen is the number of leading bytes used for detecting format.
+const sniffLen = 16
+
+var registry = struct {
+	sync.RWMutex
+	codecs    []Codec // in registration order, which is the order of sniffing
+	names     map[string]Codec
+	encodings map[string]Codec
+}{
+	names:     make(map[string]Codec),
+	encodings: make(map[string]Codec),
+}
+
+func init() {
+	RegisterCodec(Gzip, "gzip", "x-gzip")
+	RegisterCodec(Bzip2, "bzip2")
+	RegisterCodec(Zstd, "zstd")
+	RegisterCodec(LZ4, "lz4")
+	RegisterCodec(Snappy, "x-snappy-framed")
+	// the "deflate" content encoding is zlib format actually, see RFC 9110.
+	RegisterCodec(Zlib, "deflate")
+	RegisterCodec(Deflate)
+}
+
+// RegisterCodec registers a codec, which could be looked up by its name, or by the
+// given HTTP Content-Encoding values. Decompress detects the codec by magic bytes if
+// it implements Sniffer. Registering a codec with an existing name replaces the old one.
+func RegisterCodec(codec Codec, contentEncodings ...string) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	name := strings.ToLower(codec.Name())
+	if old, ok := registry.names[name]; ok {
+		for i, c := range registry.codecs {
+			if c == old {
+				registry.codecs = append(registry.codecs[:i], registry.codecs[i+1:]...)
+				break
+			}
+		}
+	}
+
+	registry.codecs = append(registry.codecs, codec)
+	registry.names[name] = codec
+	for _, encoding := range contentEncodings {
+		registry.encodings[strings.ToLower(encoding)] = codec
+	}
+}
+
+// CodecByName returns the codec registered with name, such as "gzip", "zlib", "deflate",
+// "bzip2", "snappy", "lz4" and "zstd".
+func CodecByName(name string) (Codec, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	codec, ok := registry.names[strings.ToLower(name)]
+	return codec, ok
+}
+
+// CodecByContentEncoding returns the codec for an HTTP Content-Encoding value, such as
+// "gzip" and "deflate". Note that "deflate" content encoding is zlib codec.
+func CodecByContentEncoding(encoding string) (Codec, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	codec, ok := registry.encodings[strings.ToLower(strings.TrimSpace(encoding))]
+	return codec, ok
+}
+
+// Detect detects the codec of the data in r by magic bytes. It returns a reader that
+// reads the same data as r did, since the leading bytes have been consumed from r.
+func Detect(r io.Reader) (Codec, io.Reader, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, br, err
+	}
+
+	codec := detect(header)
+	if codec == nil {
+		return nil, br, ErrUnknownFormat
+	}
+
+	return codec, br, nil
+}
+
+func detect(header []byte) Codec {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	for _, codec := range registry.codecs {
+		if s, ok := codec.(Sniffer); ok && s.Sniff(header) {
+			return codec
+		}
+	}
+
+	return nil
+}
+
+// CompressWith compress data from given reader with codec and write into given writer.
+func CompressWith(codec Codec, from io.Reader, to io.Writer) error {
+	writer, err := codec.NewWriter(to)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(writer, from); err != nil {
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
+
+// DecompressWith decompress data from given reader with codec and then write into given writer.
+// The decompressed data could be limited by options as Decompress does.
+func DecompressWith(codec Codec, from io.Reader, to io.Writer, opts ...Option) error {
+	return Decompress(from, to, append(opts, WithCodec(codec))...)
+}
+
+// Built-in codecs.
+var (
+	// Gzip is the gzip codec, see RFC 1952.
+	Gzip Codec = gzipCodec{}
+	// Zlib is the zlib codec, see RFC 1950.
+	Zlib Codec = zlibCodec{}
+	// Deflate is the raw deflate codec without any header, see RFC 1951. It could not be detected.
+	Deflate Codec = deflateCodec{}
+	// Bzip2 is the bzip2 codec, which supports decompressing only.
+	Bzip2 Codec = bzip2Codec{}
+	// Snappy is the snappy codec in framing format.
+	Snappy Codec = snappyCodec{}
+	// LZ4 is the lz4 codec in frame format.
+	LZ4 Codec = lz4Codec{}
+	// Zstd is the zstandard codec, see RFC 8878.
+	Zstd Codec = zstdCodec{}
+)
+
+type gzipCodec struct{}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (c gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return c.NewWriterLevel(w, gzip.DefaultCompression)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return newGzipReader(r)
+}
+
+func (gzipCodec) Sniff(header []byte) bool {
+	return bytes.HasPrefix(header, []byte{0x1f, 0x8b})
+}
+
+type zlibCodec struct{}
+
+func (zlibCodec) Name() string { return "zlib" }
+
+func (zlibCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriter(w), nil
+}
+
+func (zlibCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+// Sniff checks the CMF and FLG bytes: compression method must be deflate with
+// window size no more than 32K, CMF*256 + FLG must be a multiple of 31, and no preset
+// dictionary is required. Since ordinary text such as "x^" passes the check as well,
+// the deflate data following them must be decodable.
+func (zlibCodec) Sniff(header []byte) bool {
+	// the shortest zlib stream is 8 bytes: CMF, FLG, an empty deflate block and ADLER32
+	if len(header) < 8 {
+		return false
+	}
+
+	cmf, flg := header[0], header[1]
+	if cmf&0x0f != 8 || cmf>>4 > 7 || (uint16(cmf)<<8|uint16(flg))%31 != 0 || flg&0x20 != 0 {
+		return false
+	}
+
+	fr := flate.NewReader(bytes.NewReader(header[2:]))
+	defer fr.Close()
+
+	// the header is truncated, so that running out of data doesn't make it invalid
+	_, err := fr.Read(make([]byte, 1))
+	return err == nil || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+type deflateCodec struct{}
+
+func (deflateCodec) Name() string { return "deflate" }
+
+func (deflateCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, flate.DefaultCompression)
+}
+
+func (deflateCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
+type bzip2Codec struct{}
+
+func (bzip2Codec) Name() string { return "bzip2" }
+
+func (bzip2Codec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nil, ErrNotSupported
+}
+
+func (bzip2Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bzip2.NewReader(r)), nil
+}
+
+func (bzip2Codec) Sniff(header []byte) bool {
+	return len(header) >= 4 && bytes.HasPrefix(header, []byte("BZh")) && header[3] >= '1' && header[3] <= '9'
+}
+
+type snappyCodec struct{}
+
+func (snappyCodec) Name() string { return "snappy" }
+
+func (snappyCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (snappyCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(snappy.NewReader(r)), nil
+}
+
+// Sniff checks the stream identifier chunk.
+func (snappyCodec) Sniff(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("\xff\x06\x00\x00sNaPpY"))
+}
+
+type lz4Codec struct{}
+
+func (lz4Codec) Name() string { return "lz4" }
+
+func (lz4Codec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return lz4.NewWriter(w), nil
+}
+
+func (lz4Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(lz4.NewReader(r)), nil
+}
+
+func (lz4Codec) Sniff(header []byte) bool {
+	return bytes.HasPrefix(header, []byte{0x04, 0x22, 0x4d, 0x18})
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return "zstd" }
+
+func (zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+func (zstdCodec) Sniff(header []byte) bool {
+	return bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd})
+}
@@ -1,56 +1,26 @@
 package compress
 
 import (
-	"compress/gzip"
 	"io"
 )
 
-// Compress compress data from given reader and write into given writer
+// Compress compress data from given reader with gzip and write into given writer
 func Compress(from io.Reader, to io.Writer) error {
-	writer := gzip.NewWriter(to)
-	defer writer.Close() // 一定要Close
-
-	buf := make([]byte, 1024)
-	for {
-		count, err := from.Read(buf)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		currentBytes := buf[:count]
-		if _, err := writer.Write(currentBytes); err != nil {
-			return err
-		}
-		writer.Flush() // 手动flush，否则得不到数据
-	}
-
-	return nil
+	return CompressWith(Gzip, from, to)
 }
 
-// Decompress decompress data from given reader and then write into given writer
-func Decompress(from io.Reader, to io.Writer) error {
-	reader, err := gzip.NewReader(from)
+// Decompress decompress data from given reader and then write into given writer.
+// The compression format is detected by magic bytes, see Detect.
+//
+// Use WithMaxSize and WithMaxRatio to limit the decompressed data, a *LimitError
+// is returned once a limit is exceeded, and the data written is within the limits.
+func Decompress(from io.Reader, to io.Writer, opts ...Option) error {
+	reader, err := NewReader(from, opts...)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 
-	buf := make([]byte, 1024)
-	for {
-		count, err := reader.Read(buf)
-		if err == io.EOF {
-			return nil
-		}
-		if err != nil {
-			return err
-		}
-
-		currentBytes := buf[:count]
-		if _, err := to.Write(currentBytes); err != nil {
-			return err
-		}
-	}
+	_, err = io.Copy(to, reader)
+	return err
 }
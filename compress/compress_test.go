@@ -0,0 +1,327 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+var testData = bytes.Repeat([]byte("randomdata 123456789 "), 1000)
+
+func TestCodecs(t *testing.T) {
+	for _, name := range []string{"gzip", "zlib", "snappy", "lz4", "zstd"} {
+		codec, ok := CodecByName(name)
+		if !ok {
+			t.Fatalf("codec %s not found", name)
+		}
+
+		var compressed bytes.Buffer
+		if err := CompressWith(codec, bytes.NewReader(testData), &compressed); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// format should be detected by Decompress
+		var output bytes.Buffer
+		if err := Decompress(&compressed, &output); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if !bytes.Equal(output.Bytes(), testData) {
+			t.Fatalf("%s: decompressed data mismatch", name)
+		}
+	}
+}
+
+func TestDetect_Zlib(t *testing.T) {
+	for _, text := range []string{"x^abcdefghijklmnop", "x^", "x} braces", "x\x9cnot compressed at all"} {
+		if codec, _, err := Detect(strings.NewReader(text)); err != ErrUnknownFormat {
+			t.Fatalf("text %q should not be detected, but got %v", text, codec)
+		}
+	}
+
+	for _, data := range [][]byte{nil, []byte("a"), testData} {
+		for _, level := range []int{flate.NoCompression, flate.BestSpeed, flate.DefaultCompression, flate.BestCompression} {
+			var compressed bytes.Buffer
+			w, _ := NewWriter(&compressed, WithCodec(Zlib), WithLevel(level))
+			w.Write(data)
+			w.Close()
+
+			if codec, _, err := Detect(&compressed); err != nil || codec != Zlib {
+				t.Fatalf("zlib stream of %d bytes at level %d should be detected, but got %v", len(data), level, err)
+			}
+		}
+	}
+}
+
+func TestDecompress_Unknown(t *testing.T) {
+	var compressed bytes.Buffer
+	if err := CompressWith(Deflate, bytes.NewReader(testData), &compressed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Decompress(bytes.NewReader(compressed.Bytes()), &bytes.Buffer{}); err != ErrUnknownFormat {
+		t.Fatalf("raw deflate could not be detected, but got error %v", err)
+	}
+
+	var output bytes.Buffer
+	if err := DecompressWith(Deflate, &compressed, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(output.Bytes(), testData) {
+		t.Fatalf("decompressed data mismatch")
+	}
+}
+
+func TestCodecByContentEncoding(t *testing.T) {
+	for encoding, name := range map[string]string{"gzip": "gzip", "X-Gzip": "gzip", "deflate": "zlib", "zstd": "zstd"} {
+		codec, ok := CodecByContentEncoding(encoding)
+		if !ok || codec.Name() != name {
+			t.Fatalf("wanted codec %s for content encoding %s", name, encoding)
+		}
+	}
+
+	if _, err := Bzip2.NewWriter(&bytes.Buffer{}); err != ErrNotSupported {
+		t.Fatalf("bzip2 should not support compressing")
+	}
+}
+
+func TestWriterReader(t *testing.T) {
+	for _, codec := range []Codec{Gzip, Zlib, Zstd, LZ4} {
+		for _, level := range []int{flate.DefaultCompression, flate.BestSpeed, flate.BestCompression} {
+			var compressed bytes.Buffer
+			w, err := NewWriter(&compressed, WithCodec(codec), WithLevel(level), WithBufferSize(512))
+			if err != nil {
+				t.Fatalf("%s: %v", codec.Name(), err)
+			}
+
+			for i := 0; i < len(testData); i += 100 {
+				end := i + 100
+				if end > len(testData) {
+					end = len(testData)
+				}
+				w.Write(testData[i:end])
+			}
+
+			if err := w.Flush(); err != nil {
+				t.Fatalf("%s: %v", codec.Name(), err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("%s: %v", codec.Name(), err)
+			}
+
+			r, err := NewReader(&compressed)
+			if err != nil {
+				t.Fatalf("%s: %v", codec.Name(), err)
+			}
+
+			output, err := ioutil.ReadAll(r)
+			r.Close()
+			if err != nil {
+				t.Fatalf("%s: %v", codec.Name(), err)
+			}
+
+			if !bytes.Equal(output, testData) {
+				t.Fatalf("%s: decompressed data mismatch", codec.Name())
+			}
+		}
+	}
+}
+
+func TestCompress_Ratio(t *testing.T) {
+	var compressed bytes.Buffer
+	if err := Compress(bytes.NewReader(testData), &compressed); err != nil {
+		t.Fatal(err)
+	}
+
+	// the data is highly repetitive, it should not be flushed in small chunks.
+	if compressed.Len() > len(testData)/50 {
+		t.Fatalf("compressed size %v is too large", compressed.Len())
+	}
+}
+
+func BenchmarkCompress(b *testing.B) {
+	data := bytes.Repeat(testData, 100)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Compress(bytes.NewReader(data), ioutil.Discard)
+	}
+}
+
+func TestParallelWriter(t *testing.T) {
+	data := bytes.Repeat(testData, 50)
+	for _, size := range []int{0, 1, 1000, len(data)} {
+		var compressed bytes.Buffer
+		err := CompressParallel(bytes.NewReader(data[:size]), &compressed, WithBlockSize(64*1024), WithConcurrency(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the multi-member stream should be readable by gzip.Reader
+		gr, err := gzip.NewReader(bytes.NewReader(compressed.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		output, err := ioutil.ReadAll(gr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(output, data[:size]) {
+			t.Fatalf("size %v: decompressed data mismatch", size)
+		}
+
+		var decompressed bytes.Buffer
+		if err := Decompress(&compressed, &decompressed); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decompressed.Bytes(), data[:size]) {
+			t.Fatalf("size %v: decompressed data mismatch", size)
+		}
+	}
+}
+
+func BenchmarkCompressParallel(b *testing.B) {
+	data := bytes.Repeat(testData, 100)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		CompressParallel(bytes.NewReader(data), ioutil.Discard)
+	}
+}
+
+func TestDecompress_Limits(t *testing.T) {
+	// 10MB zeros compress to about 10KB
+	bomb := make([]byte, 10<<20)
+	var compressed bytes.Buffer
+	if err := Compress(bytes.NewReader(bomb), &compressed); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	err := Decompress(bytes.NewReader(compressed.Bytes()), &output, WithMaxSize(1<<20))
+	limitErr, ok := err.(*LimitError)
+	if !ok || limitErr.Limit != "size" || !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("wanted size limit error but got %v", err)
+	}
+
+	if output.Len() != 1<<20 || limitErr.Decompressed != 1<<20 {
+		t.Fatalf("output should be cut off at 1MB, but got %v bytes", output.Len())
+	}
+
+	output.Reset()
+	err = Decompress(bytes.NewReader(compressed.Bytes()), &output, WithMaxRatio(100))
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != "ratio" {
+		t.Fatalf("wanted ratio limit error but got %v", err)
+	}
+
+	if output.Len() >= len(bomb) {
+		t.Fatalf("output should be cut off, but got %v bytes", output.Len())
+	}
+
+	// data within limits
+	output.Reset()
+	err = Decompress(bytes.NewReader(compressed.Bytes()), &output, WithMaxSize(int64(len(bomb))), WithMaxRatio(10000))
+	if err != nil || output.Len() != len(bomb) {
+		t.Fatalf("wanted %v bytes without error, but got %v bytes and error %v", len(bomb), output.Len(), err)
+	}
+}
+
+func dictSamples(n int) [][]byte {
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = []byte(fmt.Sprintf(`{"user_id":%d,"name":"user-%d","status":"active","roles":["reader","writer"],"created_at":"2021-06-%02dT10:00:00Z"}`, i, i*7, i%28+1))
+	}
+	return samples
+}
+
+func TestBuildDictionary(t *testing.T) {
+	samples := dictSamples(200)
+	dict := BuildDictionary(samples, 1024)
+	if len(dict) == 0 || len(dict) > 1024 {
+		t.Fatalf("unexpected dictionary size %d", len(dict))
+	}
+
+	if !bytes.Contains(dict, []byte(`"status":"active"`)) {
+		t.Fatalf("common substrings are missing in dictionary %q", dict)
+	}
+}
+
+func TestDictCompressor(t *testing.T) {
+	samples := dictSamples(300)
+	v1 := &Dictionary{ID: 1, Data: BuildDictionary(samples[:200], 0)}
+
+	dc, err := NewDictCompressor(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := samples[250]
+	frame, err := dc.Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var plain bytes.Buffer
+	if err := CompressWith(Deflate, bytes.NewReader(payload), &plain); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(frame) >= plain.Len() {
+		t.Fatalf("compressed with dictionary into %d bytes, but %d bytes without", len(frame), plain.Len())
+	}
+
+	if id, err := DictionaryID(frame); err != nil || id != 1 {
+		t.Fatalf("wanted dictionary 1 but got %v, %v", id, err)
+	}
+
+	// replaces the dictionary, the old frames could still be decompressed
+	v2 := &Dictionary{ID: 2, Data: BuildDictionary(samples[100:], 0)}
+	dc2, err := NewDictCompressor(v2, WithCodec(Zlib))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dc2.Decompress(frame); !errors.Is(err, ErrUnknownDictionary) {
+		t.Fatalf("wanted ErrUnknownDictionary but got %v", err)
+	}
+
+	dc2.AddDictionary(v1)
+	for _, f := range [][]byte{frame, mustCompress(t, dc2, payload)} {
+		data, err := dc2.Decompress(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, payload) {
+			t.Fatalf("decompressed data mismatched: %q", data)
+		}
+	}
+
+	if _, err := dc2.Decompress(payload); !errors.Is(err, ErrInvalidFrame) {
+		t.Fatalf("wanted ErrInvalidFrame but got %v", err)
+	}
+
+	if _, err := NewDictCompressor(v1, WithCodec(Gzip)); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("wanted ErrNotSupported but got %v", err)
+	}
+
+	if _, err := NewDictCompressor(v1, WithCodec(Zstd)); !errors.Is(err, ErrInvalidDictionary) {
+		t.Fatalf("wanted ErrInvalidDictionary but got %v", err)
+	}
+
+	// nil dictionaries are skipped
+	dc2.AddDictionary(nil)
+}
+
+func mustCompress(t *testing.T, dc *DictCompressor, data []byte) []byte {
+	frame, err := dc.Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
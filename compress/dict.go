@@ -0,0 +1,376 @@
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// maxDictSize is the window size of deflate, the bytes of a dictionary beyond that are useless.
+	maxDictSize = 32 * 1024
+	// dictSegmentSize is the length of the substrings counted by BuildDictionary.
+	dictSegmentSize = 16
+
+	dictFrameVersion = 1
+)
+
+// dictFrameMagic leads the frames written by DictCompressor.
+var dictFrameMagic = []byte("GDZ")
+
+// zstdDictMagic leads the dictionaries in zstd format.
+var zstdDictMagic = []byte{0x37, 0xa4, 0x30, 0xec}
+
+var (
+	// ErrUnknownDictionary is returned when decompressing a frame compressed with a
+	// dictionary that's not known by the DictCompressor.
+	ErrUnknownDictionary = errors.New("compress: unknown dictionary")
+	// ErrInvalidFrame is returned when decompressing data that's not a valid frame
+	// written by DictCompressor.
+	ErrInvalidFrame = errors.New("compress: invalid dictionary frame")
+	// ErrInvalidDictionary is returned when the dictionary is not in the format the codec
+	// requires, such as a raw content dictionary for Zstd.
+	ErrInvalidDictionary = errors.New("compress: invalid dictionary")
+)
+
+// DictCodec is implemented by codecs that support preset dictionaries. Zlib and Deflate
+// use raw content dictionaries, such as the ones built by BuildDictionary, while Zstd
+// requires dictionaries in zstd format, such as the ones trained by "zstd --train".
+type DictCodec interface {
+	Codec
+	// NewWriterDict is like LevelCodec.NewWriterLevel but compresses with dictionary dict.
+	NewWriterDict(w io.Writer, level int, dict []byte) (io.WriteCloser, error)
+	// NewReaderDict is like NewReader but decompresses with dictionary dict.
+	NewReaderDict(r io.Reader, dict []byte) (io.ReadCloser, error)
+}
+
+// WithDictionary specifies the preset dictionary for the codecs implementing DictCodec.
+// The reader must use the same dictionary as the writer did. NewWriter and NewReader
+// return ErrNotSupported if the codec doesn't support dictionaries.
+func WithDictionary(dict []byte) Option {
+	return func(opts *options) {
+		opts.dict = dict
+	}
+}
+
+// Dictionary is a preset dictionary identified by ID, which is written into the frames
+// compressed with it, so that readers know which dictionary to use. The ID of a
+// dictionary should be changed whenever its content changes.
+type Dictionary struct {
+	ID   uint32
+	Data []byte
+}
+
+// BuildDictionary builds a raw content dictionary of at most size bytes from sample
+// payloads, size 0 means 32KB, which is the most deflate could make use of. The
+// dictionary is for Zlib and Deflate only, Zstd rejects it with ErrInvalidDictionary.
+//
+// The dictionary consists of the substrings that are shared by most samples, the most
+// common ones are put at the end of the dictionary, which are cheaper to refer to.
+// Samples should be representative of the payloads to be compressed, a few hundred
+// samples are usually enough.
+func BuildDictionary(samples [][]byte, size int) []byte {
+	if size <= 0 || size > maxDictSize {
+		size = maxDictSize
+	}
+
+	// counts the number of samples containing each segment
+	counts := make(map[string]int)
+	for _, sample := range samples {
+		seen := make(map[string]struct{})
+		for i := 0; i+dictSegmentSize <= len(sample); i++ {
+			segment := string(sample[i : i+dictSegmentSize])
+			if _, ok := seen[segment]; ok {
+				continue
+			}
+			seen[segment] = struct{}{}
+			counts[segment]++
+		}
+	}
+
+	segments := make([]string, 0, len(counts))
+	for segment, count := range counts {
+		if count > 1 {
+			segments = append(segments, segment)
+		}
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		if counts[segments[i]] != counts[segments[j]] {
+			return counts[segments[i]] > counts[segments[j]]
+		}
+		return segments[i] < segments[j]
+	})
+
+	// picks the segments greedily, a segment is extended instead of appended if it
+	// overlaps with the tail of a picked one, which keeps the common substrings longer
+	// than a segment continuous.
+	var picked [][]byte
+	var total int
+	for _, segment := range segments {
+		if total >= size {
+			break
+		}
+
+		s := []byte(segment)
+		if containsSegment(picked, s) {
+			continue
+		}
+
+		if i, ok := extendSegment(picked, s); ok {
+			picked[i] = append(picked[i], s[dictSegmentSize-1:]...)
+			total++
+			continue
+		}
+
+		picked = append(picked, s)
+		total += len(s)
+	}
+
+	// the most common segments go last
+	dict := make([]byte, 0, total)
+	for i := len(picked) - 1; i >= 0; i-- {
+		dict = append(dict, picked[i]...)
+	}
+
+	if len(dict) > size {
+		dict = dict[len(dict)-size:]
+	}
+
+	return dict
+}
+
+func containsSegment(picked [][]byte, s []byte) bool {
+	for _, p := range picked {
+		if bytes.Contains(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// extendSegment finds the picked segment whose last dictSegmentSize-1 bytes are the
+// leading bytes of s.
+func extendSegment(picked [][]byte, s []byte) (int, bool) {
+	for i, p := range picked {
+		if bytes.HasSuffix(p, s[:dictSegmentSize-1]) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// DictCompressor compresses small payloads, such as cache values and messages, with
+// preset dictionaries. The compressed payload is framed as:
+//
+//	"GDZ" | version (1 byte) | codec name length (uvarint) | codec name | dictionary ID (uvarint) | compressed data
+//
+// It compresses with the current dictionary, and decompresses frames compressed with
+// any of the dictionaries known to it, so the dictionary could be replaced without
+// breaking the payloads compressed before. It's safe for concurrent use.
+type DictCompressor struct {
+	current *Dictionary
+	opts    *options
+
+	mu    sync.RWMutex
+	dicts map[uint32]*Dictionary
+}
+
+// NewDictCompressor returns a DictCompressor compressing with dictionary current.
+// WithCodec (Deflate by default), WithLevel (flate.BestCompression by default, since the
+// faster levels barely make use of dictionaries for small payloads), WithMaxSize and
+// WithMaxRatio options are supported, the codec must implement DictCodec.
+func NewDictCompressor(current *Dictionary, opts ...Option) (*DictCompressor, error) {
+	if current == nil {
+		return nil, errors.New("compress: nil dictionary")
+	}
+
+	o := newOptions(append([]Option{WithLevel(flate.BestCompression)}, opts...)...)
+	if o.codec == nil {
+		o.codec = Deflate
+	}
+
+	if _, ok := o.codec.(DictCodec); !ok {
+		return nil, fmt.Errorf("%w: %s codec doesn't support dictionaries", ErrNotSupported, o.codec.Name())
+	}
+
+	if o.codec == Zstd {
+		if err := checkZstdDict(current.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	return &DictCompressor{
+		current: current,
+		opts:    o,
+		dicts:   map[uint32]*Dictionary{current.ID: current},
+	}, nil
+}
+
+// AddDictionary adds dictionaries for decompressing the frames compressed with them,
+// typically the older versions of the current dictionary. Nil dictionaries are skipped.
+func (dc *DictCompressor) AddDictionary(dicts ...*Dictionary) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	for _, dict := range dicts {
+		if dict != nil && dict.ID != dc.current.ID {
+			dc.dicts[dict.ID] = dict
+		}
+	}
+}
+
+// Compress compresses data with the current dictionary into a frame.
+func (dc *DictCompressor) Compress(data []byte) ([]byte, error) {
+	name := dc.opts.codec.Name()
+
+	var buf bytes.Buffer
+	buf.Grow(len(data)/2 + 16)
+	buf.Write(dictFrameMagic)
+	buf.WriteByte(dictFrameVersion)
+
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], uint64(len(name)))])
+	buf.WriteString(name)
+	buf.Write(tmp[:binary.PutUvarint(tmp[:], uint64(dc.current.ID))])
+
+	w, err := dc.opts.codec.(DictCodec).NewWriterDict(&buf, dc.opts.level, dc.current.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decompress decompresses a frame written by Compress, with the codec and dictionary
+// recorded in the frame. It returns ErrUnknownDictionary if the dictionary is unknown.
+func (dc *DictCompressor) Decompress(frame []byte) ([]byte, error) {
+	codec, id, payload, err := parseDictFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	dc.mu.RLock()
+	dict, ok := dc.dicts[id]
+	dc.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownDictionary, id)
+	}
+
+	opts := []Option{WithCodec(codec), WithDictionary(dict.Data), WithMaxSize(dc.opts.maxSize), WithMaxRatio(dc.opts.maxRatio)}
+	r, err := NewReader(bytes.NewReader(payload), opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// DictionaryID returns the ID of the dictionary that frame was compressed with.
+func DictionaryID(frame []byte) (uint32, error) {
+	_, id, _, err := parseDictFrame(frame)
+	return id, err
+}
+
+func parseDictFrame(frame []byte) (Codec, uint32, []byte, error) {
+	if !bytes.HasPrefix(frame, dictFrameMagic) || len(frame) <= len(dictFrameMagic) {
+		return nil, 0, nil, ErrInvalidFrame
+	}
+
+	frame = frame[len(dictFrameMagic):]
+	if frame[0] != dictFrameVersion {
+		return nil, 0, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidFrame, frame[0])
+	}
+	frame = frame[1:]
+
+	n, size := binary.Uvarint(frame)
+	if size <= 0 || uint64(len(frame)-size) < n {
+		return nil, 0, nil, ErrInvalidFrame
+	}
+	name := string(frame[size : size+int(n)])
+	frame = frame[size+int(n):]
+
+	id, size := binary.Uvarint(frame)
+	if size <= 0 || id > 1<<32-1 {
+		return nil, 0, nil, ErrInvalidFrame
+	}
+	frame = frame[size:]
+
+	codec, ok := CodecByName(name)
+	if !ok {
+		return nil, 0, nil, fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+	}
+
+	return codec, uint32(id), frame, nil
+}
+
+func (zlibCodec) NewWriterDict(w io.Writer, level int, dict []byte) (io.WriteCloser, error) {
+	return zlib.NewWriterLevelDict(w, level, dict)
+}
+
+func (zlibCodec) NewReaderDict(r io.Reader, dict []byte) (io.ReadCloser, error) {
+	return zlib.NewReaderDict(r, dict)
+}
+
+func (deflateCodec) NewWriterDict(w io.Writer, level int, dict []byte) (io.WriteCloser, error) {
+	return flate.NewWriterDict(w, level, dict)
+}
+
+func (deflateCodec) NewReaderDict(r io.Reader, dict []byte) (io.ReadCloser, error) {
+	return flate.NewReaderDict(r, dict), nil
+}
+
+// NewWriterDict requires a dictionary in zstd format.
+func (zstdCodec) NewWriterDict(w io.Writer, level int, dict []byte) (io.WriteCloser, error) {
+	if err := checkZstdDict(dict); err != nil {
+		return nil, err
+	}
+
+	opts := []zstd.EOption{zstd.WithEncoderDict(dict)}
+	if level != flate.DefaultCompression {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(zstdLevel(level))))
+	}
+
+	return zstd.NewWriter(w, opts...)
+}
+
+// NewReaderDict requires a dictionary in zstd format.
+func (zstdCodec) NewReaderDict(r io.Reader, dict []byte) (io.ReadCloser, error) {
+	if err := checkZstdDict(dict); err != nil {
+		return nil, err
+	}
+
+	decoder, err := zstd.NewReader(r, zstd.WithDecoderDicts(dict))
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+// checkZstdDict checks that dict is in zstd format, zstd doesn't use raw content
+// dictionaries, such as the ones built by BuildDictionary.
+func checkZstdDict(dict []byte) error {
+	if !bytes.HasPrefix(dict, zstdDictMagic) {
+		return fmt.Errorf("%w: zstd requires a dictionary in zstd format, such as the ones trained by \"zstd --train\"", ErrInvalidDictionary)
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package httpcompress
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiandahao/goutils/compress"
+)
+
+// Handler returns a net/http middleware that compresses responses according to the
+// Accept-Encoding header, and decompresses request bodies according to the
+// Content-Encoding header. Request bodies encoded by gzip or the encodings of
+// WithEncodings are accepted, others are rejected with 415.
+//
+// A response is compressed only if its content type is allowed, its body is not
+// shorter than the minimum size, and it's not encoded by the handler already. The
+// response writer supports http.Flusher, http.Hijacker and http.Pusher if the
+// underlying one does, the response is not compressed once the connection is hijacked.
+func Handler(next http.Handler, opts ...Option) http.Handler {
+	c := newConfig(opts...)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := c.decompressRequest(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		cw := c.newCompressWriter(w, r)
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// GinMiddleware returns a gin middleware that works as Handler does.
+func GinMiddleware(opts ...Option) gin.HandlerFunc {
+	c := newConfig(opts...)
+
+	return func(ctx *gin.Context) {
+		if err := c.decompressRequest(ctx.Request); err != nil {
+			ctx.AbortWithError(http.StatusUnsupportedMediaType, err)
+			return
+		}
+
+		cw := c.newCompressWriter(ctx.Writer, ctx.Request)
+		ctx.Writer = &ginResponseWriter{ResponseWriter: ctx.Writer, cw: cw}
+		defer cw.Close()
+
+		ctx.Next()
+	}
+}
+
+// decompressRequest replaces the compressed request body with a decompressing reader.
+func (c *config) decompressRequest(r *http.Request) error {
+	encoding := r.Header.Get("Content-Encoding")
+	if encoding == "" || strings.EqualFold(encoding, "identity") || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	codec, ok := compress.CodecByContentEncoding(encoding)
+	if !ok || !c.acceptRequestCodec(codec) {
+		return compress.ErrUnknownFormat
+	}
+
+	reader, err := compress.NewReader(r.Body, append(c.readerOptions(), compress.WithCodec(codec))...)
+	if err != nil {
+		return err
+	}
+
+	r.Body = &readCloser{Reader: reader, closers: []func() error{reader.Close, r.Body.Close}}
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+
+	return nil
+}
+
+// acceptRequestCodec reports whether the request bodies compressed by codec are
+// decompressed, gzip is always accepted.
+func (c *config) acceptRequestCodec(codec compress.Codec) bool {
+	if codec == compress.Gzip {
+		return true
+	}
+
+	for _, encoding := range c.encodings {
+		if accepted, ok := compress.CodecByContentEncoding(encoding); ok && accepted == codec {
+			return true
+		}
+	}
+	return false
+}
+
+// readCloser reads from Reader and calls all closers once closed.
+type readCloser struct {
+	Reader  io.Reader
+	closers []func() error
+}
+
+func (rc *readCloser) Read(p []byte) (int, error) {
+	return rc.Reader.Read(p)
+}
+
+func (rc *readCloser) Close() error {
+	var err error
+	for _, closer := range rc.closers {
+		if e := closer(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// compressWriter buffers the response body until it could decide whether to compress
+// the response, that is, the buffered body reaches the minimum size, or the handler
+// flushes or finishes.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *config
+	encoding string
+	codec    compress.Codec
+
+	status   int
+	buf      []byte
+	decided  bool
+	disabled bool             // the response is never compressed
+	writer   *compress.Writer // nil if response is not compressed
+}
+
+func (c *config) newCompressWriter(w http.ResponseWriter, r *http.Request) *compressWriter {
+	cw := &compressWriter{ResponseWriter: w, c: c}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	encoding, codec, ok := c.negotiate(r.Header.Get("Accept-Encoding"))
+	if !ok || r.Method == http.MethodHead {
+		cw.decided = true
+		return cw
+	}
+
+	cw.encoding, cw.codec = encoding, codec
+	return cw
+}
+
+// WriteHeader delays writing the status code until the encoding is decided.
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.decided {
+		cw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
+	if cw.status == 0 {
+		cw.status = statusCode
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.c.minSize {
+			return len(p), nil
+		}
+
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.writer != nil {
+		return cw.writer.Write(p)
+	}
+
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush flushes the compressed data to the client.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide()
+	}
+
+	if cw.writer != nil {
+		cw.writer.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection. The buffered body is written
+// uncompressed, and the compressed data is flushed before the connection is hijacked.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	if !cw.decided {
+		cw.disabled = true
+		if cw.status == 0 && len(cw.buf) == 0 {
+			// nothing is written, the connection is taken over as is
+			cw.decided = true
+		} else if err := cw.decide(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if cw.writer != nil {
+		err := cw.writer.Close()
+		cw.writer = nil
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return hijacker.Hijack()
+}
+
+// Push initiates an HTTP/2 server push if the underlying writer supports it.
+func (cw *compressWriter) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := cw.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
+}
+
+// Close decides the encoding if it's not decided yet, and flushes all pending data.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if err := cw.decide(); err != nil {
+			return err
+		}
+	}
+
+	if cw.writer != nil {
+		return cw.writer.Close()
+	}
+
+	return nil
+}
+
+// decide decides whether to compress the response, writes the header and the buffered body.
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	status := cw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if cw.shouldCompress(status) {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+
+		writer, err := compress.NewWriter(cw.ResponseWriter, compress.WithCodec(cw.codec), compress.WithLevel(cw.c.level))
+		if err != nil {
+			return err
+		}
+		cw.writer = writer
+	}
+
+	cw.ResponseWriter.WriteHeader(status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	buf := cw.buf
+	cw.buf = nil
+	if cw.writer != nil {
+		_, err := cw.writer.Write(buf)
+		return err
+	}
+
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+func (cw *compressWriter) shouldCompress(status int) bool {
+	if cw.disabled || len(cw.buf) < cw.c.minSize || status < http.StatusOK ||
+		status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+
+	return cw.c.allowContentType(header.Get("Content-Type"))
+}
+
+// ginResponseWriter makes compressWriter a gin.ResponseWriter.
+type ginResponseWriter struct {
+	gin.ResponseWriter
+	cw *compressWriter
+}
+
+func (w *ginResponseWriter) WriteHeader(statusCode int) {
+	w.cw.WriteHeader(statusCode)
+}
+
+// WriteHeaderNow is called by gin to write the header without body, the header is
+// delayed as well until the encoding is decided.
+func (w *ginResponseWriter) WriteHeaderNow() {
+	if w.cw.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *ginResponseWriter) Write(p []byte) (int, error) {
+	return w.cw.Write(p)
+}
+
+func (w *ginResponseWriter) WriteString(s string) (int, error) {
+	return w.cw.Write([]byte(s))
+}
+
+func (w *ginResponseWriter) Flush() {
+	w.cw.Flush()
+}
+
+func (w *ginResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.cw.Hijack()
+}
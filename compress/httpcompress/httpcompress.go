@@ -0,0 +1,165 @@
+// Package httpcompress provides HTTP middlewares and client transport that compress
+// and decompress HTTP bodies with the compress package.
+package httpcompress
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/jiandahao/goutils/compress"
+)
+
+type config struct {
+	encodings       []string // supported content encodings in order of preference
+	contentTypes    []string
+	minSize         int
+	level           int
+	maxBodySize     int64
+	requestEncoding string
+}
+
+// Option configs the middlewares and transport.
+type Option func(c *config)
+
+// WithEncodings specifies the supported content encodings in order of preference,
+// "gzip" and "deflate" by default. The encodings must be registered in compress package.
+func WithEncodings(encodings ...string) Option {
+	return func(c *config) {
+		c.encodings = encodings
+	}
+}
+
+// WithContentTypes specifies the media types of responses to be compressed, a type
+// ending with "/*" such as "text/*" matches all its subtypes. By default, text, JSON,
+// XML, JavaScript and SVG responses are compressed.
+func WithContentTypes(contentTypes ...string) Option {
+	return func(c *config) {
+		c.contentTypes = contentTypes
+	}
+}
+
+// WithMinSize specifies the minimum body size to be compressed, 1024 bytes by default.
+// Compressing small bodies is not worth it.
+func WithMinSize(size int) Option {
+	return func(c *config) {
+		c.minSize = size
+	}
+}
+
+// WithLevel specifies the compression level, see compress.WithLevel.
+func WithLevel(level int) Option {
+	return func(c *config) {
+		c.level = level
+	}
+}
+
+// WithMaxBodySize specifies the maximum size of decompressed bodies, 0 means no limit.
+// Reading a body beyond the limit fails with *compress.LimitError.
+func WithMaxBodySize(size int64) Option {
+	return func(c *config) {
+		c.maxBodySize = size
+	}
+}
+
+// WithRequestEncoding specifies the content encoding, such as "gzip", for compressing
+// request bodies sent by transport. Request bodies are not compressed by default.
+func WithRequestEncoding(encoding string) Option {
+	return func(c *config) {
+		c.requestEncoding = encoding
+	}
+}
+
+func newConfig(opts ...Option) *config {
+	c := &config{
+		encodings: []string{"gzip", "deflate"},
+		contentTypes: []string{
+			"text/*",
+			"application/json",
+			"application/javascript",
+			"application/xml",
+			"application/x-ndjson",
+			"image/svg+xml",
+		},
+		minSize: 1024,
+		level:   -1, // flate.DefaultCompression
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *config) readerOptions() []compress.Option {
+	if c.maxBodySize <= 0 {
+		return nil
+	}
+	return []compress.Option{compress.WithMaxSize(c.maxBodySize)}
+}
+
+// allowContentType reports whether the response with contentType should be compressed.
+func (c *config) allowContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range c.contentTypes {
+		if strings.HasSuffix(t, "/*") {
+			if strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) {
+				return true
+			}
+		} else if mediaType == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// negotiate selects the content encoding for response according to the Accept-Encoding
+// header, it returns false if no supported encoding is acceptable.
+func (c *config) negotiate(acceptEncoding string) (string, compress.Codec, bool) {
+	if acceptEncoding == "" {
+		return "", nil, false
+	}
+
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		encoding := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted[encoding] = q
+	}
+
+	var best string
+	var bestQ float64
+	for _, encoding := range c.encodings {
+		q, ok := accepted[encoding]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+
+		// the earlier encoding wins if they have the same quality
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	if best == "" {
+		return "", nil, false
+	}
+
+	codec, ok := compress.CodecByContentEncoding(best)
+	return best, codec, ok
+}
@@ -0,0 +1,259 @@
+package httpcompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiandahao/goutils/compress"
+)
+
+var largeText = strings.Repeat("hello, compress. ", 1024)
+
+func textHandler(body string, contentType string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Write([]byte(body))
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	c := newConfig()
+
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0", ""},
+		{"*", "gzip"},
+		{"br", ""},
+		{"br, *;q=0.1", "gzip"},
+	}
+
+	for _, tc := range cases {
+		got, _, _ := c.negotiate(tc.accept)
+		if got != tc.want {
+			t.Errorf("negotiate(%q) = %q, want %q", tc.accept, got, tc.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	cases := []struct {
+		name        string
+		body        string
+		contentType string
+		accept      string
+		compressed  bool
+	}{
+		{"gzip", largeText, "text/plain", "gzip", true},
+		{"sniffed content type", largeText, "", "gzip", true},
+		{"not accepted", largeText, "text/plain", "", false},
+		{"small body", "hello", "text/plain", "gzip", false},
+		{"content type not allowed", largeText, "image/png", "gzip", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tc.accept)
+			rec := httptest.NewRecorder()
+
+			Handler(textHandler(tc.body, tc.contentType)).ServeHTTP(rec, req)
+
+			body := rec.Body.Bytes()
+			if tc.compressed {
+				if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+					t.Fatalf("Content-Encoding = %q, want gzip", got)
+				}
+
+				gr, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body, err = ioutil.ReadAll(gr); err != nil {
+					t.Fatal(err)
+				}
+			} else if got := rec.Header().Get("Content-Encoding"); got != "" {
+				t.Fatalf("Content-Encoding = %q, want none", got)
+			}
+
+			if string(body) != tc.body {
+				t.Fatalf("body mismatched, got %d bytes, want %d bytes", len(body), len(tc.body))
+			}
+
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Fatalf("Vary = %q, want Accept-Encoding", got)
+			}
+		})
+	}
+}
+
+func TestHandler_RequestDecompression(t *testing.T) {
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	gw.Write([]byte(largeText))
+	gw.Close()
+
+	var received string
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		received = string(data)
+	}), WithMaxBodySize(int64(len(largeText))))
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || received != largeText {
+		t.Fatalf("unexpected response %d, received %d bytes", rec.Code, len(received))
+	}
+
+	// exceeds the max body size
+	handler = Handler(handler, WithMaxBodySize(1024))
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestHandler_RequestEncodings(t *testing.T) {
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), WithEncodings("deflate"))
+
+	for encoding, want := range map[string]int{"gzip": http.StatusOK, "deflate": http.StatusOK, "zstd": http.StatusUnsupportedMediaType} {
+		codec, _ := compress.CodecByContentEncoding(encoding)
+		var body bytes.Buffer
+		w, err := compress.NewWriter(&body, compress.WithCodec(codec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("body"))
+		w.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", &body)
+		req.Header.Set("Content-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != want {
+			t.Fatalf("status of %s request = %d, want %d", encoding, rec.Code, want)
+		}
+	}
+}
+
+func TestHandler_Hijack(t *testing.T) {
+	server := httptest.NewServer(Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Pusher); !ok {
+			t.Error("response writer should implement http.Pusher")
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello")
+		rw.Flush()
+	})))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello" || resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("hijacked response should not be compressed, got %q", body)
+	}
+}
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(GinMiddleware())
+	engine.GET("/", func(ctx *gin.Context) {
+		ctx.String(http.StatusCreated, largeText)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("unexpected response %d %q", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+
+	gr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(gr)
+	if err != nil || string(body) != largeText {
+		t.Fatalf("body mismatched: %v", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var received string
+	server := httptest.NewServer(Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received = string(data)
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(data)
+	})))
+	defer server.Close()
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		client := &http.Client{Transport: NewTransport(nil, WithEncodings(encoding), WithRequestEncoding(encoding))}
+
+		resp, err := client.Post(server.URL, "text/plain", strings.NewReader(largeText))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !resp.Uncompressed {
+			t.Fatalf("%s: response is not compressed", encoding)
+		}
+
+		if received != largeText || string(body) != largeText {
+			t.Fatalf("%s: body mismatched, received %d bytes, responded %d bytes", encoding, len(received), len(body))
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package httpcompress
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jiandahao/goutils/compress"
+)
+
+// transport is a http.RoundTripper that negotiates content encoding with the server.
+type transport struct {
+	base http.RoundTripper
+	c    *config
+}
+
+// NewTransport returns a http.RoundTripper that sends Accept-Encoding header with the
+// supported encodings, and decompresses the responses transparently. If WithRequestEncoding
+// is specified, request bodies are compressed as well. http.DefaultTransport is used if
+// base is nil.
+//
+// It could be used with convhttp client:
+//
+//	client := convhttp.NewClient(convhttp.WithHTTPClient(&http.Client{
+//		Transport: httpcompress.NewTransport(nil),
+//	}))
+func NewTransport(base http.RoundTripper, opts ...Option) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &transport{base: base, c: newConfig(opts...)}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+
+	if req.Header.Get("Accept-Encoding") == "" && len(t.c.encodings) > 0 {
+		req.Header.Set("Accept-Encoding", strings.Join(t.c.encodings, ", "))
+	}
+
+	if err := t.compressRequest(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.decompressResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// compressRequest replaces the request body with a compressing reader.
+func (t *transport) compressRequest(req *http.Request) error {
+	if t.c.requestEncoding == "" || req.Body == nil || req.Body == http.NoBody ||
+		req.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	if req.ContentLength >= 0 && req.ContentLength < int64(t.c.minSize) {
+		return nil
+	}
+
+	codec, ok := compress.CodecByContentEncoding(t.c.requestEncoding)
+	if !ok {
+		return compress.ErrUnknownFormat
+	}
+
+	body := req.Body
+	req.Body = t.compressBody(codec, body)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return t.compressBody(codec, body), nil
+		}
+	}
+
+	req.Header.Set("Content-Encoding", t.c.requestEncoding)
+	req.Header.Del("Content-Length")
+	req.ContentLength = -1
+
+	return nil
+}
+
+// compressBody returns a reader of the compressed body, the body is compressed in
+// a separate goroutine as it's read.
+func (t *transport) compressBody(codec compress.Codec, body io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		defer body.Close()
+
+		w, err := compress.NewWriter(pw, compress.WithCodec(codec), compress.WithLevel(t.c.level))
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		if _, err := io.Copy(w, body); err != nil {
+			w.Close()
+			pw.CloseWithError(err)
+			return
+		}
+
+		pw.CloseWithError(w.Close())
+	}()
+
+	return pr
+}
+
+// decompressResponse replaces the compressed response body with a decompressing reader.
+func (t *transport) decompressResponse(resp *http.Response) error {
+	encoding := resp.Header.Get("Content-Encoding")
+	if encoding == "" || strings.EqualFold(encoding, "identity") || resp.Body == nil || resp.Body == http.NoBody {
+		return nil
+	}
+
+	codec, ok := compress.CodecByContentEncoding(encoding)
+	if !ok {
+		// leave it to the caller
+		return nil
+	}
+
+	body := resp.Body
+	resp.Body = &lazyReadCloser{
+		open: func() (io.ReadCloser, error) {
+			return compress.NewReader(body, append(t.c.readerOptions(), compress.WithCodec(codec))...)
+		},
+		body: body,
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+
+	return nil
+}
+
+// lazyReadCloser opens the decompressing reader on first read, since creating a reader
+// reads the header of the compressed stream, which should not block RoundTrip.
+type lazyReadCloser struct {
+	open func() (io.ReadCloser, error)
+	body io.ReadCloser
+	r    io.ReadCloser
+	err  error
+}
+
+func (lr *lazyReadCloser) Read(p []byte) (int, error) {
+	if lr.r == nil && lr.err == nil {
+		lr.r, lr.err = lr.open()
+	}
+
+	if lr.err != nil {
+		return 0, lr.err
+	}
+
+	return lr.r.Read(p)
+}
+
+func (lr *lazyReadCloser) Close() error {
+	if lr.r != nil {
+		lr.r.Close()
+	}
+	return lr.body.Close()
+}
@@ -0,0 +1,124 @@
+package compress
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrLimitExceeded is matched by errors.Is for every LimitError.
+var ErrLimitExceeded = errors.New("compress: decompression limit exceeded")
+
+// minRatioCheckSize is the decompressed size under which the compression ratio is not
+// checked, since the ratio of small data could be high.
+const minRatioCheckSize = 64 * 1024
+
+// LimitError is returned when the decompressed data exceeds the limits specified by
+// WithMaxSize or WithMaxRatio. The data returned before the error is within the limits.
+type LimitError struct {
+	// Limit is the exceeded limit, "size" or "ratio".
+	Limit string
+	// Decompressed is the number of decompressed bytes returned before the error.
+	Decompressed int64
+	// Compressed is the number of compressed bytes consumed.
+	Compressed int64
+}
+
+// Error implements the error interface.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("compress: decompression %s limit exceeded after %d bytes decompressed from %d bytes",
+		e.Limit, e.Decompressed, e.Compressed)
+}
+
+// Is reports whether target is ErrLimitExceeded.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// WithMaxSize specifies the maximum number of decompressed bytes, 0 means no limit.
+// It protects from decompression bombs.
+func WithMaxSize(size int64) Option {
+	return func(opts *options) {
+		opts.maxSize = size
+	}
+}
+
+// WithMaxRatio specifies the maximum ratio of decompressed size to compressed size,
+// 0 means no limit. It's checked once the decompressed data is larger than 64KB.
+func WithMaxRatio(ratio float64) Option {
+	return func(opts *options) {
+		opts.maxRatio = ratio
+	}
+}
+
+func (o *options) limited() bool {
+	return o.maxSize > 0 || o.maxRatio > 0
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// limitReader returns LimitError once the decompressed data read from ReadCloser
+// exceeds the limits, the bytes beyond the limits are dropped.
+type limitReader struct {
+	io.ReadCloser
+	compressed *countingReader
+	maxSize    int64
+	maxRatio   float64
+	n          int64 // decompressed bytes returned
+	err        error
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	if lr.err != nil {
+		return 0, lr.err
+	}
+
+	// read one more byte than allowed, to tell whether there is more data.
+	if lr.maxSize > 0 && int64(len(p)) > lr.maxSize-lr.n+1 {
+		p = p[:lr.maxSize-lr.n+1]
+	}
+
+	n, err := lr.ReadCloser.Read(p)
+
+	if lr.maxSize > 0 && lr.n+int64(n) > lr.maxSize {
+		n = int(lr.maxSize - lr.n)
+		lr.err = lr.limitError("size", n)
+		return n, lr.err
+	}
+
+	if total := lr.n + int64(n); lr.maxRatio > 0 && total > minRatioCheckSize {
+		allowed := int64(lr.maxRatio * float64(lr.compressed.n))
+		if total > allowed {
+			if allowed < minRatioCheckSize {
+				allowed = minRatioCheckSize
+			}
+			if allowed < lr.n {
+				allowed = lr.n
+			}
+			n = int(allowed - lr.n)
+			lr.err = lr.limitError("ratio", n)
+			return n, lr.err
+		}
+	}
+
+	lr.n += int64(n)
+	return n, err
+}
+
+func (lr *limitReader) limitError(limit string, n int) error {
+	return &LimitError{
+		Limit:        limit,
+		Decompressed: lr.n + int64(n),
+		Compressed:   lr.compressed.n,
+	}
+}
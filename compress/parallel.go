@@ -0,0 +1,235 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+const defaultBlockSize = 1 << 20
+
+// ErrWriterClosed is returned when writing to a closed ParallelWriter.
+var ErrWriterClosed = errors.New("compress: writer closed")
+
+// WithBlockSize specifies the size of the blocks compressed concurrently by ParallelWriter, 1MB by default.
+func WithBlockSize(size int) Option {
+	return func(opts *options) {
+		if size > 0 {
+			opts.blockSize = size
+		}
+	}
+}
+
+// WithConcurrency specifies the maximum number of blocks compressed concurrently by
+// ParallelWriter, runtime.GOMAXPROCS(0) by default.
+func WithConcurrency(n int) Option {
+	return func(opts *options) {
+		if n > 0 {
+			opts.concurrency = n
+		}
+	}
+}
+
+// block is a chunk of input compressed as a standalone gzip member.
+type block struct {
+	in   []byte
+	out  bytes.Buffer
+	err  error
+	done chan struct{}
+}
+
+// ParallelWriter is a gzip writer that splits the input into blocks and compresses them
+// concurrently. Each block is written as a gzip member, the result is a standard
+// multi-member gzip stream, which could be read by Decompress, gzip.Reader or gunzip.
+//
+// The compression ratio is slightly worse than a single member stream, since blocks
+// are compressed independently.
+type ParallelWriter struct {
+	w         io.Writer
+	level     int
+	blockSize int
+
+	cur     []byte         // the block being filled
+	sem     chan struct{}  // limits the number of blocks being compressed
+	pending chan *block    // blocks to be written in order
+	wg      sync.WaitGroup // blocks dispatched but not written yet
+	done    chan struct{}  // closed once the writing goroutine exits
+	written bool           // whether any block has been dispatched
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// NewParallelWriter returns a parallel gzip writer that writes the compressed data into w,
+// WithLevel, WithBlockSize and WithConcurrency options are supported. Callers must close
+// the writer to flush the pending data, which doesn't close w.
+func NewParallelWriter(w io.Writer, opts ...Option) *ParallelWriter {
+	o := newOptions(opts...)
+
+	pw := &ParallelWriter{
+		w:         w,
+		level:     o.level,
+		blockSize: o.blockSize,
+		sem:       make(chan struct{}, o.concurrency),
+		pending:   make(chan *block, o.concurrency),
+		done:      make(chan struct{}),
+	}
+
+	go pw.writeLoop()
+
+	return pw
+}
+
+// Write buffers p, and dispatches the full blocks to be compressed.
+func (pw *ParallelWriter) Write(p []byte) (int, error) {
+	if err := pw.error(); err != nil {
+		return 0, err
+	}
+
+	if pw.isClosed() {
+		return 0, ErrWriterClosed
+	}
+
+	n := len(p)
+	for len(p) > 0 {
+		if pw.cur == nil {
+			pw.cur = make([]byte, 0, pw.blockSize)
+		}
+
+		c := pw.blockSize - len(pw.cur)
+		if c > len(p) {
+			c = len(p)
+		}
+		pw.cur = append(pw.cur, p[:c]...)
+		p = p[c:]
+
+		if len(pw.cur) == pw.blockSize {
+			pw.dispatch()
+		}
+	}
+
+	return n, pw.error()
+}
+
+// Flush compresses the buffered data and waits until all the compressed data has been
+// written into the underlying writer.
+func (pw *ParallelWriter) Flush() error {
+	if err := pw.error(); err != nil {
+		return err
+	}
+
+	if len(pw.cur) > 0 {
+		pw.dispatch()
+	}
+
+	pw.wg.Wait()
+	return pw.error()
+}
+
+// Close flushes the pending data and stops the writer.
+func (pw *ParallelWriter) Close() error {
+	pw.mu.Lock()
+	if pw.closed {
+		pw.mu.Unlock()
+		return pw.error()
+	}
+	pw.closed = true
+	pw.mu.Unlock()
+
+	if pw.error() == nil && (len(pw.cur) > 0 || !pw.written) {
+		// an empty input is written as an empty gzip member, to be a valid gzip stream.
+		pw.dispatch()
+	}
+
+	close(pw.pending)
+	<-pw.done
+
+	return pw.error()
+}
+
+// CompressParallel compresses data from given reader with ParallelWriter and write into given writer.
+func CompressParallel(from io.Reader, to io.Writer, opts ...Option) error {
+	pw := NewParallelWriter(to, opts...)
+	if _, err := io.Copy(pw, from); err != nil {
+		pw.Close()
+		return err
+	}
+
+	return pw.Close()
+}
+
+func (pw *ParallelWriter) dispatch() {
+	b := &block{in: pw.cur, done: make(chan struct{})}
+	pw.cur = nil
+	pw.written = true
+
+	pw.wg.Add(1)
+	pw.sem <- struct{}{}
+	go func() {
+		defer func() {
+			<-pw.sem
+			close(b.done)
+		}()
+
+		gw, err := Gzip.(LevelCodec).NewWriterLevel(&b.out, pw.level)
+		if err != nil {
+			b.err = err
+			return
+		}
+
+		if _, err := gw.Write(b.in); err != nil {
+			gw.Close()
+			b.err = err
+			return
+		}
+
+		b.err = gw.Close()
+	}()
+
+	pw.pending <- b
+}
+
+// writeLoop writes the compressed blocks in the order they were dispatched.
+func (pw *ParallelWriter) writeLoop() {
+	defer close(pw.done)
+
+	for b := range pw.pending {
+		<-b.done
+
+		err := b.err
+		if err == nil && pw.error() == nil {
+			_, err = pw.w.Write(b.out.Bytes())
+		}
+
+		if err != nil {
+			pw.setError(err)
+		}
+
+		pw.wg.Done()
+	}
+}
+
+func (pw *ParallelWriter) isClosed() bool {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	return pw.closed
+}
+
+func (pw *ParallelWriter) error() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	return pw.err
+}
+
+func (pw *ParallelWriter) setError(err error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	if pw.err == nil {
+		pw.err = err
+	}
+}
@@ -0,0 +1,301 @@
+package compress
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const defaultBufferSize = 32 * 1024
+
+// LevelCodec is implemented by codecs that support compression levels.
+type LevelCodec interface {
+	Codec
+	// NewWriterLevel is like NewWriter but specifies the compression level. The levels
+	// range from flate.BestSpeed (1) to flate.BestCompression (9), flate.DefaultCompression (-1)
+	// means the default level of the codec.
+	NewWriterLevel(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+type options struct {
+	codec       Codec
+	level       int
+	bufferSize  int
+	blockSize   int
+	concurrency int
+	maxSize     int64
+	maxRatio    float64
+	dict        []byte
+}
+
+// Option configs the compressing writer and decompressing reader.
+type Option func(opts *options)
+
+// WithCodec specifies the codec, gzip is used for writer by default, and reader detects
+// the codec by magic bytes by default.
+func WithCodec(codec Codec) Option {
+	return func(opts *options) {
+		opts.codec = codec
+	}
+}
+
+// WithLevel specifies the compression level for the codecs implementing LevelCodec,
+// flate.DefaultCompression by default.
+func WithLevel(level int) Option {
+	return func(opts *options) {
+		opts.level = level
+	}
+}
+
+// WithBufferSize specifies the size of the buffer in front of the writer or reader, 32KB by default.
+func WithBufferSize(size int) Option {
+	return func(opts *options) {
+		if size > 0 {
+			opts.bufferSize = size
+		}
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		level:       flate.DefaultCompression,
+		bufferSize:  defaultBufferSize,
+		blockSize:   defaultBlockSize,
+		concurrency: runtime.GOMAXPROCS(0),
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// Writer is a compressing writer. Written data is buffered, and it's compressed
+// only when the buffer is full, or Flush or Close is called.
+type Writer struct {
+	bw *bufio.Writer
+	cw io.WriteCloser
+}
+
+// NewWriter returns a writer that compresses the data written to it into w.
+// Callers must close the writer to flush the pending data, which doesn't close w.
+func NewWriter(w io.Writer, opts ...Option) (*Writer, error) {
+	o := newOptions(opts...)
+	if o.codec == nil {
+		o.codec = Gzip
+	}
+
+	var cw io.WriteCloser
+	var err error
+	if o.dict != nil {
+		dc, ok := o.codec.(DictCodec)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s codec doesn't support dictionaries", ErrNotSupported, o.codec.Name())
+		}
+		cw, err = dc.NewWriterDict(w, o.level, o.dict)
+	} else if lc, ok := o.codec.(LevelCodec); ok {
+		cw, err = lc.NewWriterLevel(w, o.level)
+	} else {
+		cw, err = o.codec.NewWriter(w)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		bw: bufio.NewWriterSize(cw, o.bufferSize),
+		cw: cw,
+	}, nil
+}
+
+// Write writes p into buffer.
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.bw.Write(p)
+}
+
+// Flush compresses the buffered data, and flushes the pending compressed data into
+// the underlying writer if the codec supports flushing. Flushing too often hurts the
+// compression ratio, it's for cases like sending a message over network.
+func (w *Writer) Flush() error {
+	if err := w.bw.Flush(); err != nil {
+		return err
+	}
+
+	if f, ok := w.cw.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+// Close flushes the buffered data and closes the compressing writer.
+func (w *Writer) Close() error {
+	if err := w.bw.Flush(); err != nil {
+		w.cw.Close()
+		return err
+	}
+
+	return w.cw.Close()
+}
+
+// NewReader returns a reader that decompresses the data read from r. The codec is
+// detected by magic bytes unless WithCodec is specified, and the decompressed data is
+// limited by WithMaxSize and WithMaxRatio. Callers should close the reader after use,
+// which doesn't close r.
+func NewReader(r io.Reader, opts ...Option) (io.ReadCloser, error) {
+	o := newOptions(opts...)
+
+	cr := &countingReader{r: r}
+	br := bufio.NewReaderSize(cr, o.bufferSize)
+
+	codec := o.codec
+	from := io.Reader(br)
+	if codec == nil {
+		var err error
+		if codec, from, err = Detect(br); err != nil {
+			return nil, err
+		}
+	}
+
+	var rc io.ReadCloser
+	var err error
+	if o.dict != nil {
+		dc, ok := codec.(DictCodec)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s codec doesn't support dictionaries", ErrNotSupported, codec.Name())
+		}
+		rc, err = dc.NewReaderDict(from, o.dict)
+	} else {
+		rc, err = codec.NewReader(from)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !o.limited() {
+		return rc, nil
+	}
+
+	return &limitReader{
+		ReadCloser: rc,
+		compressed: cr,
+		maxSize:    o.maxSize,
+		maxRatio:   o.maxRatio,
+	}, nil
+}
+
+// gzip writers and readers are pooled, since they take hundreds of kilobytes of memory.
+var (
+	// gzipWriterPools are indexed by level - gzip.HuffmanOnly.
+	gzipWriterPools [gzip.BestCompression - gzip.HuffmanOnly + 1]sync.Pool
+	gzipReaderPool  sync.Pool
+)
+
+func (c gzipCodec) NewWriterLevel(w io.Writer, level int) (io.WriteCloser, error) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		// let gzip report the error
+		return gzip.NewWriterLevel(w, level)
+	}
+
+	pool := &gzipWriterPools[level-gzip.HuffmanOnly]
+	if gw, ok := pool.Get().(*gzip.Writer); ok {
+		gw.Reset(w)
+		return &pooledGzipWriter{Writer: gw, pool: pool}, nil
+	}
+
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pooledGzipWriter{Writer: gw, pool: pool}, nil
+}
+
+// pooledGzipWriter puts the gzip writer back to pool once closed.
+type pooledGzipWriter struct {
+	*gzip.Writer
+	pool *sync.Pool
+}
+
+func (w *pooledGzipWriter) Close() error {
+	if w.Writer == nil {
+		return nil
+	}
+
+	err := w.Writer.Close()
+	w.pool.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
+
+func newGzipReader(r io.Reader) (io.ReadCloser, error) {
+	if gr, ok := gzipReaderPool.Get().(*gzip.Reader); ok {
+		if err := gr.Reset(r); err != nil {
+			gzipReaderPool.Put(gr)
+			return nil, err
+		}
+		return &pooledGzipReader{Reader: gr}, nil
+	}
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pooledGzipReader{Reader: gr}, nil
+}
+
+// pooledGzipReader puts the gzip reader back to pool once closed.
+type pooledGzipReader struct {
+	*gzip.Reader
+}
+
+func (r *pooledGzipReader) Close() error {
+	if r.Reader == nil {
+		return nil
+	}
+
+	err := r.Reader.Close()
+	gzipReaderPool.Put(r.Reader)
+	r.Reader = nil
+	return err
+}
+
+func (zlibCodec) NewWriterLevel(w io.Writer, level int) (io.WriteCloser, error) {
+	return zlib.NewWriterLevel(w, level)
+}
+
+func (deflateCodec) NewWriterLevel(w io.Writer, level int) (io.WriteCloser, error) {
+	return flate.NewWriter(w, level)
+}
+
+// NewWriterLevel maps level 1-9 to the zstd levels, from the fastest to the best compression.
+func (zstdCodec) NewWriterLevel(w io.Writer, level int) (io.WriteCloser, error) {
+	if level == flate.DefaultCompression {
+		return zstd.NewWriter(w)
+	}
+
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(zstdLevel(level))))
+}
+
+// zstdLevel maps level 1-9 to the zstd levels: 1 fastest, 3 default, 7 better, 11 best.
+func zstdLevel(level int) int {
+	switch {
+	case level >= 9:
+		return 11
+	case level >= 7:
+		return 7
+	case level >= 4:
+		return 3
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,151 @@
+package priorityqueue
+
+import (
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func intLess(x, y interface{}) bool {
+	return x.(int) < y.(int)
+}
+
+func intKey(x interface{}) uint64 {
+	return uint64(x.(int))
+}
+
+var backends = []struct {
+	name string
+	opt  Option
+}{
+	{name: "BinaryHeap", opt: func(pq *PriorityQueue) {}},
+	{name: "4aryHeap", opt: SetDaryHeap(4)},
+	{name: "PairingHeap", opt: SetPairingHeap()},
+	{name: "RadixHeap", opt: SetRadixHeap(intKey)},
+}
+
+func TestPriorityQueue_Backends(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			queue := New(intLess, b.opt)
+
+			data := rand.Perm(1000)
+			for _, n := range data {
+				queue.Push(n)
+			}
+
+			if queue.Len() != len(data) {
+				t.Fatalf("length should be %v, but got %v", len(data), queue.Len())
+			}
+
+			sort.Ints(data)
+			for _, n := range data {
+				if top := queue.Top(); top != n {
+					t.Fatalf("wanted top %v but got %v", n, top)
+				}
+				if got := queue.Pop(); got != n {
+					t.Fatalf("wanted %v but got %v", n, got)
+				}
+			}
+
+			if queue.Top() != nil {
+				t.Fatalf("queue should be empty")
+			}
+		})
+	}
+}
+
+func TestPriorityQueue_BackendsStable(t *testing.T) {
+	type job struct {
+		priority int
+		id       int
+	}
+
+	less := func(x, y interface{}) bool {
+		return x.(job).priority < y.(job).priority
+	}
+
+	key := func(x interface{}) uint64 {
+		return uint64(x.(job).priority)
+	}
+
+	opts := []Option{SetDaryHeap(4), SetPairingHeap(), SetRadixHeap(key)}
+	for i, opt := range opts {
+		queue := New(less, SetStable(), opt)
+
+		// interleave pushes and pops to exercise redistribution in the radix heap.
+		id := 0
+		for round := 0; round < 10; round++ {
+			for j := 0; j < 30; j++ {
+				queue.Push(job{priority: round + j%3, id: id})
+				id++
+			}
+
+			last := job{priority: -1, id: -1}
+			for k := 0; k < 10; k++ {
+				j := queue.Pop().(job)
+				if j.priority < last.priority || (j.priority == last.priority && j.id < last.id) {
+					t.Fatalf("option %d: job %+v popped after %+v", i, j, last)
+				}
+				last = j
+			}
+		}
+	}
+}
+
+func TestPriorityQueue_RadixHeapMonotone(t *testing.T) {
+	queue := New(intLess, SetRadixHeap(intKey))
+	queue.Push(10)
+	queue.Pop()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("pushing a key less than the last popped one should panic")
+		}
+	}()
+	queue.Push(5)
+}
+
+func TestPriorityQueue_RadixHeapWithCapacity(t *testing.T) {
+	if _, err := OpenDurable(filepath.Join(t.TempDir(), "queue.wal"), intLess, intCodec{},
+		SetQueueOptions(SetRadixHeap(intKey), SetCapacity(10))); !errors.Is(err, ErrRadixHeapWithCapacity) {
+		t.Fatalf("wanted ErrRadixHeapWithCapacity but got %v", err)
+	}
+
+	defer func() {
+		if r := recover(); r != ErrRadixHeapWithCapacity {
+			t.Fatalf("wanted panic with ErrRadixHeapWithCapacity but got %v", r)
+		}
+	}()
+	New(intLess, SetRadixHeap(intKey), SetCapacity(10))
+}
+
+func BenchmarkPriorityQueue_Backends_Push(b *testing.B) {
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			queue := New(intLess, backend.opt)
+			for i := 0; i < b.N; i++ {
+				queue.Push(i)
+			}
+		})
+	}
+}
+
+func BenchmarkPriorityQueue_Backends_PushPop(b *testing.B) {
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			queue := New(intLess, backend.opt)
+			for i := 0; i < 1024; i++ {
+				queue.Push(i)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// keys never go backwards, so that the radix heap could be compared as well.
+				queue.Push(queue.Pop().(int) + 1024)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package priorityqueue
+
+// daryHeap is a d-ary min heap stored in a slice, the children of the
+// element at index i are located at indexes [d*i+1, d*i+d].
+type daryHeap struct {
+	d    int
+	data []interface{}
+	less lessFunc
+}
+
+func newDaryHeap(d int, less lessFunc) *daryHeap {
+	if d < 2 {
+		d = 2
+	}
+
+	return &daryHeap{
+		d:    d,
+		less: less,
+	}
+}
+
+// Len returns the number of elements.
+func (h *daryHeap) Len() int {
+	return len(h.data)
+}
+
+func (h *daryHeap) push(x interface{}) {
+	h.data = append(h.data, x)
+	h.up(len(h.data) - 1)
+}
+
+func (h *daryHeap) pop() interface{} {
+	n := len(h.data) - 1
+	res := h.data[0]
+	h.data[0] = h.data[n]
+	h.data[n] = nil // avoid memory leak
+	h.data = h.data[:n]
+	if n > 0 {
+		h.down(0)
+	}
+	return res
+}
+
+func (h *daryHeap) top() interface{} {
+	return h.data[0]
+}
+
+func (h *daryHeap) each(fn func(x interface{})) {
+	for _, x := range h.data {
+		fn(x)
+	}
+}
+
+func (h *daryHeap) up(i int) {
+	x := h.data[i]
+	for i > 0 {
+		parent := (i - 1) / h.d
+		if !h.less(x, h.data[parent]) {
+			break
+		}
+		h.data[i] = h.data[parent]
+		i = parent
+	}
+	h.data[i] = x
+}
+
+func (h *daryHeap) down(i int) {
+	n := len(h.data)
+	x := h.data[i]
+	for {
+		first := h.d*i + 1
+		if first >= n {
+			break
+		}
+
+		// find the minimum child
+		min := first
+		last := first + h.d
+		if last > n {
+			last = n
+		}
+		for c := first + 1; c < last; c++ {
+			if h.less(h.data[c], h.data[min]) {
+				min = c
+			}
+		}
+
+		if !h.less(h.data[min], x) {
+			break
+		}
+		h.data[i] = h.data[min]
+		i = min
+	}
+	h.data[i] = x
+}
@@ -0,0 +1,658 @@
+package priorityqueue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Codec encodes and decodes the elements persisted by a DurableQueue.
+type Codec interface {
+	// Marshal returns the encoding of x.
+	Marshal(x interface{}) ([]byte, error)
+	// Unmarshal decodes data into an element.
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// SyncPolicy represents when a DurableQueue fsyncs its write-ahead file.
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs after every push and pop, no acknowledged operation will be
+	// lost, even if the machine crashes.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs periodically, see SetSyncInterval. Operations done
+	// in the last interval may be lost if the machine crashes.
+	SyncInterval
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+// ErrClosed is returned when operating on a closed DurableQueue.
+var ErrClosed = errors.New("priorityqueue: queue closed")
+
+// ErrCorrupted is returned by OpenDurable when a record of the write-ahead file is
+// corrupted, the file is left untouched for recovery.
+var ErrCorrupted = errors.New("priorityqueue: write-ahead file corrupted")
+
+const (
+	walMagic = "GPQWAL01"
+
+	recordPush byte = 1
+	recordPop  byte = 2
+
+	maxRecordSize = 1 << 30
+)
+
+// DurableQueue is a PriorityQueue whose pushes and pops are logged to an append-only
+// write-ahead file, so that pending elements survive restarts. The file is compacted
+// once popped records outnumber the live ones.
+//
+// It is safe for concurrent use by multiple goroutines.
+type DurableQueue struct {
+	pq    *PriorityQueue
+	codec Codec
+	path  string
+	file  *os.File
+
+	syncPolicy       SyncPolicy
+	syncInterval     time.Duration
+	compactThreshold int
+	queueOptions     []Option
+
+	offset int64 // size of valid records in file
+	dead   int   // number of popped records in file
+	dirty  bool  // whether there are writes not yet synced
+	closed bool
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+// DurableOption configs how to open a durable priority queue.
+type DurableOption func(dq *DurableQueue)
+
+// SetQueueOptions sets the options of the underlying priority queue.
+func SetQueueOptions(opts ...Option) DurableOption {
+	return func(dq *DurableQueue) {
+		dq.queueOptions = append(dq.queueOptions, opts...)
+	}
+}
+
+// SetSyncPolicy sets the fsync policy, SyncAlways by default.
+func SetSyncPolicy(policy SyncPolicy) DurableOption {
+	return func(dq *DurableQueue) {
+		dq.syncPolicy = policy
+	}
+}
+
+// SetSyncInterval sets the fsync interval for SyncInterval policy, one second by default.
+func SetSyncInterval(interval time.Duration) DurableOption {
+	return func(dq *DurableQueue) {
+		dq.syncInterval = interval
+	}
+}
+
+// SetCompactThreshold sets the minimum number of popped records before the
+// write-ahead file will be compacted, 1024 by default.
+func SetCompactThreshold(threshold int) DurableOption {
+	return func(dq *DurableQueue) {
+		dq.compactThreshold = threshold
+	}
+}
+
+// OpenDurable opens the durable priority queue logged in file path, creating it
+// if it doesn't exist, and rebuilds the heap from the elements that were pushed
+// but not popped yet.
+//
+// less is used to compare two elements, it should return true if x is considered to go before y.
+func OpenDurable(path string, less func(x interface{}, y interface{}) bool, codec Codec, opts ...DurableOption) (*DurableQueue, error) {
+	if codec == nil {
+		return nil, fmt.Errorf("priorityqueue: invalid codec")
+	}
+
+	dq := &DurableQueue{
+		codec:            codec,
+		path:             path,
+		syncPolicy:       SyncAlways,
+		syncInterval:     time.Second,
+		compactThreshold: 1024,
+		done:             make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(dq)
+	}
+
+	// the records identify elements by their sequence numbers
+	pq, err := newQueue(less, append(dq.queueOptions, boxItems())...)
+	if err != nil {
+		return nil, err
+	}
+	dq.pq = pq
+
+	if err := dq.load(); err != nil {
+		if dq.file != nil {
+			dq.file.Close()
+		}
+		return nil, err
+	}
+
+	if dq.syncPolicy == SyncInterval {
+		go dq.syncLoop()
+	}
+
+	return dq, nil
+}
+
+// Push pushes element into queue. The element is persisted before being pushed.
+func (dq *DurableQueue) Push(x interface{}) error {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+
+	if dq.closed {
+		return ErrClosed
+	}
+
+	data, err := dq.codec.Marshal(x)
+	if err != nil {
+		return err
+	}
+
+	pq := dq.pq
+	pq.Lock()
+	defer pq.Unlock()
+
+	it := &item{value: x, seq: pq.seq}
+	if checker, ok := pq.s.(pushChecker); ok {
+		// an element rejected in memory must not be logged, or it comes back on replay
+		if err := checker.checkPush(it); err != nil {
+			return err
+		}
+	}
+
+	if err := dq.writeRecord(encodeRecord(recordPush, pq.seq, data)); err != nil {
+		return err
+	}
+
+	pq.s.push(it)
+	pq.seq++
+	if pq.capacity > 0 && pq.s.Len() > pq.capacity {
+		// the evicted element has been dropped from memory already, failing to log
+		// it only makes it come back after restart.
+		evicted := pq.s.pop().(*item)
+		if err := dq.writeRecord(encodeRecord(recordPop, evicted.seq, nil)); err != nil {
+			return err
+		}
+		dq.dead++
+	}
+
+	return dq.maybeCompact()
+}
+
+// Pop removes and returns the top element. The element is removed only after
+// its removal has been persisted.
+func (dq *DurableQueue) Pop() (interface{}, error) {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+
+	if dq.closed {
+		return nil, ErrClosed
+	}
+
+	pq := dq.pq
+	pq.Lock()
+	defer pq.Unlock()
+
+	if pq.s.Len() == 0 {
+		return nil, nil
+	}
+
+	top := pq.s.top().(*item)
+	if err := dq.writeRecord(encodeRecord(recordPop, top.seq, nil)); err != nil {
+		return nil, err
+	}
+
+	pq.s.pop()
+	dq.dead++
+
+	return top.value, dq.maybeCompact()
+}
+
+// Top accesses the top element (considered as minimum element) from the heap.
+func (dq *DurableQueue) Top() interface{} {
+	return dq.pq.Top()
+}
+
+// Len returns the total number of elements.
+func (dq *DurableQueue) Len() int {
+	return dq.pq.Len()
+}
+
+// Sync commits the write-ahead file to stable storage.
+func (dq *DurableQueue) Sync() error {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+
+	if dq.closed {
+		return ErrClosed
+	}
+
+	return dq.sync()
+}
+
+// Compact rewrites the write-ahead file so that it only contains the elements in queue.
+func (dq *DurableQueue) Compact() error {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+
+	if dq.closed {
+		return ErrClosed
+	}
+
+	dq.pq.Lock()
+	defer dq.pq.Unlock()
+
+	return dq.compact()
+}
+
+// Close syncs and closes the write-ahead file.
+func (dq *DurableQueue) Close() error {
+	dq.mu.Lock()
+	defer dq.mu.Unlock()
+
+	if dq.closed {
+		return nil
+	}
+
+	dq.closed = true
+	close(dq.done)
+
+	if err := dq.file.Sync(); err != nil {
+		dq.file.Close()
+		return err
+	}
+
+	return dq.file.Close()
+}
+
+func (dq *DurableQueue) syncLoop() {
+	ticker := time.NewTicker(dq.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dq.done:
+			return
+		case <-ticker.C:
+			dq.mu.Lock()
+			if !dq.closed {
+				dq.sync()
+			}
+			dq.mu.Unlock()
+		}
+	}
+}
+
+func (dq *DurableQueue) sync() error {
+	if !dq.dirty {
+		return nil
+	}
+
+	if err := dq.file.Sync(); err != nil {
+		return err
+	}
+
+	dq.dirty = false
+	return nil
+}
+
+func (dq *DurableQueue) writeRecord(data []byte) error {
+	if _, err := dq.file.Write(data); err != nil {
+		// drop the partially written record, otherwise records appended later
+		// would be unreachable when replaying.
+		if terr := dq.file.Truncate(dq.offset); terr != nil {
+			return fmt.Errorf("priorityqueue: failed to drop partial record: %v, write error: %w", terr, err)
+		}
+		if _, serr := dq.file.Seek(dq.offset, io.SeekStart); serr != nil {
+			return fmt.Errorf("priorityqueue: failed to drop partial record: %v, write error: %w", serr, err)
+		}
+		return err
+	}
+
+	dq.offset += int64(len(data))
+	dq.dirty = true
+	if dq.syncPolicy == SyncAlways {
+		return dq.sync()
+	}
+
+	return nil
+}
+
+func (dq *DurableQueue) maybeCompact() error {
+	if dq.dead < dq.compactThreshold || dq.dead < dq.pq.s.Len() {
+		return nil
+	}
+
+	return dq.compact()
+}
+
+// compact writes all elements in queue into a temporary file, and then replaces
+// the write-ahead file with it atomically.
+func (dq *DurableQueue) compact() error {
+	var items []*item
+	var size int64
+	dq.pq.s.each(func(x interface{}) {
+		items = append(items, x.(*item))
+	})
+
+	// keep the insertion order, so that elements are pushed in the same order when rebuilding.
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].seq < items[j].seq
+	})
+
+	tmpPath := dq.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	err = func() error {
+		n, err := w.WriteString(walMagic)
+		if err != nil {
+			return err
+		}
+		size += int64(n)
+
+		for _, x := range items {
+			data, err := dq.codec.Marshal(x.value)
+			if err != nil {
+				return err
+			}
+
+			n, err := w.Write(encodeRecord(recordPush, x.seq, data))
+			if err != nil {
+				return err
+			}
+			size += int64(n)
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		return tmp.Sync()
+	}()
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, dq.path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	syncDir(filepath.Dir(dq.path))
+
+	dq.file.Close()
+	dq.file = tmp
+	dq.offset = size
+	dq.dead = 0
+	dq.dirty = false
+
+	return nil
+}
+
+// load rebuilds the queue from the write-ahead file. A torn or invalid record at the
+// end of the file, which is left by a crash in the middle of writing, is truncated,
+// while corrupted records followed by valid ones and read errors fail the loading.
+func (dq *DurableQueue) load() error {
+	file, err := os.OpenFile(dq.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	items, dead, size, err := dq.replay(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	if size == 0 {
+		// new file
+		if _, err := file.WriteString(walMagic); err != nil {
+			file.Close()
+			return err
+		}
+		size = int64(len(walMagic))
+	}
+
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return err
+	}
+
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	dq.file = file
+	dq.offset = size
+	dq.dead = dead
+
+	pq := dq.pq
+	for _, x := range items {
+		pq.s.push(x)
+		if x.seq >= pq.seq {
+			pq.seq = x.seq + 1
+		}
+
+		if pq.capacity > 0 && pq.s.Len() > pq.capacity {
+			// the eviction is logged as Push does, so that the element doesn't come back
+			evicted := pq.s.pop().(*item)
+			if err := dq.writeRecord(encodeRecord(recordPop, evicted.seq, nil)); err != nil {
+				return err
+			}
+			dq.dead++
+		}
+	}
+
+	return dq.maybeCompact()
+}
+
+// replay reads records from file, it returns elements pushed but not popped yet in
+// insertion order, the number of popped records and the size of valid records.
+func (dq *DurableQueue) replay(file *os.File) (items []*item, dead int, size int64, err error) {
+	r := bufio.NewReader(file)
+
+	magic := make([]byte, len(walMagic))
+	n, err := io.ReadFull(r, magic)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if n > 0 && !bytes.HasPrefix([]byte(walMagic), magic[:n]) {
+			return nil, 0, 0, fmt.Errorf("priorityqueue: %s is not a write-ahead file", dq.path)
+		}
+		return nil, 0, 0, nil
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if string(magic) != walMagic {
+		return nil, 0, 0, fmt.Errorf("priorityqueue: %s is not a write-ahead file", dq.path)
+	}
+
+	size = int64(len(walMagic))
+	live := make(map[uint64][]byte)
+	for {
+		typ, seq, data, n, err := decodeRecord(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// the end of file, or a torn record left by a crash at the end of file
+			break
+		}
+		if errors.Is(err, ErrCorrupted) {
+			// a crash could leave garbage after the last record as well, such as the zeros
+			// of preallocated space, while the records after a corrupted one must not be
+			// dropped silently.
+			valid, scanErr := hasValidRecord(file, size+1)
+			if scanErr != nil {
+				return nil, 0, 0, scanErr
+			}
+			if !valid {
+				break
+			}
+		}
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("priorityqueue: failed to replay %s at offset %d: %w", dq.path, size, err)
+		}
+		size += int64(n)
+
+		switch typ {
+		case recordPush:
+			live[seq] = data
+		case recordPop:
+			delete(live, seq)
+			dead++
+		}
+	}
+
+	for seq, data := range live {
+		x, err := dq.codec.Unmarshal(data)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		items = append(items, &item{value: x, seq: seq})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].seq < items[j].seq
+	})
+
+	return items, dead, size, nil
+}
+
+// hasValidRecord reports whether a valid record starts at any offset of file after offset.
+func hasValidRecord(file *os.File, offset int64) (bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if offset >= info.Size() {
+		return false, nil
+	}
+
+	rest := make([]byte, info.Size()-offset)
+	if _, err := file.ReadAt(rest, offset); err != nil && err != io.EOF {
+		return false, err
+	}
+
+	for i := range rest {
+		if rest[i] != recordPush && rest[i] != recordPop {
+			continue
+		}
+
+		_, _, _, _, err := decodeRecord(bufio.NewReader(bytes.NewReader(rest[i:])))
+		if err == nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// encodeRecord encodes a record as:
+//
+//	type (1 byte) | seq (uvarint) | length of data (uvarint) | data | crc32 of all above (4 bytes)
+func encodeRecord(typ byte, seq uint64, data []byte) []byte {
+	buf := make([]byte, 1+2*binary.MaxVarintLen64+len(data)+4)
+	buf[0] = typ
+	n := 1
+	n += binary.PutUvarint(buf[n:], seq)
+	n += binary.PutUvarint(buf[n:], uint64(len(data)))
+	n += copy(buf[n:], data)
+	binary.LittleEndian.PutUint32(buf[n:], crc32.ChecksumIEEE(buf[:n]))
+	return buf[:n+4]
+}
+
+// decodeRecord reads a record from r and returns it along with its encoded size.
+func decodeRecord(r *bufio.Reader) (typ byte, seq uint64, data []byte, size int, err error) {
+	typ, err = r.ReadByte()
+	if err != nil {
+		return
+	}
+
+	if typ != recordPush && typ != recordPop {
+		err = fmt.Errorf("%w: invalid record type %d", ErrCorrupted, typ)
+		return
+	}
+
+	seq, err = readUvarint(r)
+	if err != nil {
+		return
+	}
+
+	length, err := readUvarint(r)
+	if err != nil {
+		return
+	}
+
+	if length > maxRecordSize {
+		err = fmt.Errorf("%w: record too large", ErrCorrupted)
+		return
+	}
+
+	header := make([]byte, 1+2*binary.MaxVarintLen64)
+	header[0] = typ
+	n := 1
+	n += binary.PutUvarint(header[n:], seq)
+	n += binary.PutUvarint(header[n:], length)
+
+	buf := make([]byte, int(length)+4)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return
+	}
+
+	data = buf[:length]
+	checksum := crc32.Update(crc32.ChecksumIEEE(header[:n]), crc32.IEEETable, data)
+	if binary.LittleEndian.Uint32(buf[length:]) != checksum {
+		err = fmt.Errorf("%w: checksum mismatch", ErrCorrupted)
+		return
+	}
+
+	return typ, seq, data, n + len(buf), nil
+}
+
+// readUvarint reads a uvarint from r, an overflowed one is reported as ErrCorrupted.
+func readUvarint(r *bufio.Reader) (uint64, error) {
+	x, err := binary.ReadUvarint(r)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	return x, err
+}
+
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
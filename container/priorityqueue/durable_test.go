@@ -0,0 +1,256 @@
+package priorityqueue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+type intCodec struct{}
+
+func (c intCodec) Marshal(x interface{}) ([]byte, error) {
+	return []byte(strconv.Itoa(x.(int))), nil
+}
+
+func (c intCodec) Unmarshal(data []byte) (interface{}, error) {
+	return strconv.Atoi(string(data))
+}
+
+func TestDurableQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	queue, err := OpenDurable(path, intLess, intCodec{}, SetCompactThreshold(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 50; i > 0; i-- {
+		if err := queue.Push(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i <= 20; i++ {
+		n, err := queue.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n.(int) != i {
+			t.Fatalf("wanted %v but got %v", i, n)
+		}
+	}
+
+	if err := queue.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a crash in the middle of writing a record
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(encodeRecord(recordPush, 1000, []byte("1"))[:3])
+	file.Close()
+
+	queue, err = OpenDurable(path, intLess, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+
+	if queue.Len() != 30 {
+		t.Fatalf("length should be 30, but got %v", queue.Len())
+	}
+
+	// records appended after the torn one should be readable
+	if err := queue.Push(0); err != nil {
+		t.Fatal(err)
+	}
+
+	queue.Close()
+	queue, err = OpenDurable(path, intLess, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+
+	for i := 20; i <= 50; i++ {
+		n, err := queue.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := i
+		if i == 20 {
+			want = 0
+		}
+		if n.(int) != want {
+			t.Fatalf("wanted %v but got %v", want, n)
+		}
+	}
+}
+
+func TestDurableQueue_Corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	queue, err := OpenDurable(path, intLess, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		queue.Push(i)
+	}
+	queue.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flip a byte of the payload of the second record
+	offset := len(walMagic) + len(encodeRecord(recordPush, 0, []byte("0"))) + 3
+	data[offset] ^= 0xff
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenDurable(path, intLess, intCodec{}); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("wanted ErrCorrupted but got %v", err)
+	}
+
+	// the records after the corrupted one are kept
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(data)) {
+		t.Fatalf("file should be untouched, but its size changed from %d to %d", len(data), info.Size())
+	}
+}
+
+func TestDurableQueue_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	queue, err := OpenDurable(path, intLess, intCodec{},
+		SetCompactThreshold(100), SetSyncPolicy(SyncNever))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		queue.Push(i)
+		queue.Pop()
+	}
+	queue.Push(1)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() > 1024 {
+		t.Fatalf("file should have been compacted, but got size %v", info.Size())
+	}
+
+	queue.Close()
+
+	queue, err = OpenDurable(path, intLess, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+
+	if queue.Len() != 1 || queue.Top() != 1 {
+		t.Fatalf("wanted only element 1, but got length %v and top %v", queue.Len(), queue.Top())
+	}
+}
+
+func TestDurableQueue_InvalidTail(t *testing.T) {
+	for name, tail := range map[string][]byte{
+		"zeros":          make([]byte, 64),
+		"invalid record": append(encodeRecord(recordPush, 10, []byte("10"))[:4], 0xff, 0xff, 0xff, 0xff, 0xff),
+	} {
+		path := filepath.Join(t.TempDir(), "queue.wal")
+
+		queue, err := OpenDurable(path, intLess, intCodec{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			queue.Push(i)
+		}
+		queue.Close()
+
+		// simulate a crash after a preallocated or partly written record
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write(tail)
+		file.Close()
+
+		queue, err = OpenDurable(path, intLess, intCodec{})
+		if err != nil {
+			t.Fatalf("%s: invalid tail should be truncated, but got %v", name, err)
+		}
+		if queue.Len() != 3 {
+			t.Fatalf("%s: length should be 3, but got %v", name, queue.Len())
+		}
+		queue.Close()
+	}
+}
+
+func TestDurableQueue_CapacityOnLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	queue, err := OpenDurable(path, intLess, intCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		queue.Push(i)
+	}
+	queue.Close()
+
+	// the elements evicted while loading don't come back
+	for _, opts := range [][]DurableOption{{SetQueueOptions(SetCapacity(3))}, nil} {
+		queue, err = OpenDurable(path, intLess, intCodec{}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if queue.Len() != 3 {
+			t.Fatalf("length should be 3, but got %v", queue.Len())
+		}
+		queue.Close()
+	}
+}
+
+func TestDurableQueue_RadixHeapKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+	key := func(x interface{}) uint64 { return uint64(x.(int)) }
+
+	queue, err := OpenDurable(path, intLess, intCodec{}, SetQueueOptions(SetRadixHeap(key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Push(5)
+	queue.Pop()
+
+	if err := queue.Push(3); !errors.Is(err, ErrRadixHeapKey) {
+		t.Fatalf("wanted ErrRadixHeapKey but got %v", err)
+	}
+	queue.Close()
+
+	// the rejected element is not logged
+	queue, err = OpenDurable(path, intLess, intCodec{}, SetQueueOptions(SetRadixHeap(key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+
+	if queue.Len() != 0 {
+		t.Fatalf("queue should be empty, but got length %v", queue.Len())
+	}
+}
@@ -0,0 +1,109 @@
+package priorityqueue
+
+type pairingNode struct {
+	x       interface{}
+	child   *pairingNode // leftmost child
+	sibling *pairingNode // next sibling on the right
+}
+
+// pairingHeap is a min pairing heap. Push melds a single-node heap into the
+// root in O(1), and pop merges the children of the root with the two-pass
+// pairing strategy in O(log n) amortized time.
+type pairingHeap struct {
+	root *pairingNode
+	size int
+	less lessFunc
+}
+
+func newPairingHeap(less lessFunc) *pairingHeap {
+	return &pairingHeap{
+		less: less,
+	}
+}
+
+// Len returns the number of elements.
+func (h *pairingHeap) Len() int {
+	return h.size
+}
+
+func (h *pairingHeap) push(x interface{}) {
+	h.root = h.meld(h.root, &pairingNode{x: x})
+	h.size++
+}
+
+func (h *pairingHeap) pop() interface{} {
+	res := h.root.x
+	h.root = h.mergePairs(h.root.child)
+	h.size--
+	return res
+}
+
+func (h *pairingHeap) top() interface{} {
+	return h.root.x
+}
+
+func (h *pairingHeap) each(fn func(x interface{})) {
+	if h.root == nil {
+		return
+	}
+
+	stack := []*pairingNode{h.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		fn(n.x)
+		for c := n.child; c != nil; c = c.sibling {
+			stack = append(stack, c)
+		}
+	}
+}
+
+// meld links two heaps by making the root with greater element the leftmost child of the other.
+func (h *pairingHeap) meld(a, b *pairingNode) *pairingNode {
+	if a == nil {
+		return b
+	}
+
+	if b == nil {
+		return a
+	}
+
+	if h.less(b.x, a.x) {
+		a, b = b, a
+	}
+
+	b.sibling = a.child
+	a.child = b
+	return a
+}
+
+// mergePairs merges a list of sibling heaps into one. It melds siblings in pairs from
+// left to right, and then melds the resulting heaps from right to left.
+func (h *pairingHeap) mergePairs(first *pairingNode) *pairingNode {
+	var pairs *pairingNode // melded pairs, linked in reverse order through sibling
+	for first != nil {
+		a := first
+		b := a.sibling
+		if b == nil {
+			first = nil
+		} else {
+			first = b.sibling
+			b.sibling = nil
+		}
+		a.sibling = nil
+
+		merged := h.meld(a, b)
+		merged.sibling = pairs
+		pairs = merged
+	}
+
+	var root *pairingNode
+	for pairs != nil {
+		next := pairs.sibling
+		pairs.sibling = nil
+		root = h.meld(pairs, root)
+		pairs = next
+	}
+
+	return root
+}
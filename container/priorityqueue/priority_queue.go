@@ -2,6 +2,7 @@ package priorityqueue
 
 import (
 	"container/heap"
+	"errors"
 	"sync"
 )
 
@@ -9,15 +10,22 @@ import (
 // It is safe for concurrent use by multiple
 // goroutines without additional locking or coordination.
 type PriorityQueue struct {
-	s        *innerSlice
-	capacity int // maximum size of queue.
+	s        backend
+	capacity int    // maximum size of queue.
+	stable   bool   // whether equal elements are popped in insertion order.
+	boxed    bool   // whether elements are wrapped into items with sequence numbers.
+	radix    bool   // whether the backend is a radix heap.
+	seq      uint64 // insertion sequence number of the next pushed element.
 	sync.RWMutex
+
+	newBackend func(less lessFunc) backend
 }
 
 // Option configs how to initialize a priority queue
 type Option func(pq *PriorityQueue)
 
-// SetCapacity sets the capacity of the queue.
+// SetCapacity sets the capacity of the queue, the minimum element is evicted when
+// the queue is full. It can't be used with SetRadixHeap.
 //
 // capacity < 0 represents Infinite capacity.
 func SetCapacity(capacity int) Option {
@@ -26,20 +34,138 @@ func SetCapacity(capacity int) Option {
 	}
 }
 
+// SetStable makes elements considered equal by less be popped in the order
+// they were pushed (FIFO), instead of the arbitrary order given by the heap.
+func SetStable() Option {
+	return func(pq *PriorityQueue) {
+		pq.stable = true
+	}
+}
+
+// SetDaryHeap uses a d-ary heap instead of the default binary heap. A 4-ary heap
+// has a shallower tree than a binary one, which makes push cheaper and tends to be
+// more cache friendly.
+//
+// d < 2 falls back to 2.
+func SetDaryHeap(d int) Option {
+	return func(pq *PriorityQueue) {
+		pq.newBackend = func(less lessFunc) backend {
+			return newDaryHeap(d, less)
+		}
+	}
+}
+
+// SetPairingHeap uses a pairing heap instead of the default binary heap. Pushing
+// into a pairing heap is an O(1) meld, while popping costs O(log n) amortized.
+func SetPairingHeap() Option {
+	return func(pq *PriorityQueue) {
+		pq.newBackend = func(less lessFunc) backend {
+			return newPairingHeap(less)
+		}
+	}
+}
+
+// SetRadixHeap uses a radix heap instead of the default binary heap. key maps an
+// element to its integer priority, smaller keys are popped first, and the less
+// function passed to New is ignored.
+//
+// A radix heap is monotone: pushing an element whose key is smaller than the key
+// of the last popped element panics with ErrRadixHeapKey. It fits workloads such as timers and
+// Dijkstra's algorithm, where keys never go backwards.
+//
+// It can't be used with SetCapacity, whose eviction pops the minimum element and
+// makes later pushes of smaller keys panic, see ErrRadixHeapWithCapacity.
+func SetRadixHeap(key func(x interface{}) uint64) Option {
+	return func(pq *PriorityQueue) {
+		pq.radix = true
+		pq.newBackend = func(less lessFunc) backend {
+			return newRadixHeap(pq.elementKey(key), pq.stable)
+		}
+	}
+}
+
+// ErrRadixHeapWithCapacity is the panic value of New, and the error of OpenDurable,
+// when SetRadixHeap is used with SetCapacity.
+var ErrRadixHeapWithCapacity = errors.New("priorityqueue: SetRadixHeap can't be used with SetCapacity")
+
+// ErrRadixHeapKey is the panic value of PriorityQueue.Push, and the error of
+// DurableQueue.Push, when the key of the pushed element is less than the key of the
+// last popped element of a radix heap.
+var ErrRadixHeapKey = errors.New("priorityqueue: radix heap key is less than the last popped key")
+
 // New new a priority queue.
 //
 // less is used to compare two elements, it should return true if x is considered to go before y.
+// It panics with ErrRadixHeapWithCapacity if SetRadixHeap is used with SetCapacity.
 func New(less func(x interface{}, y interface{}) bool, opts ...Option) *PriorityQueue {
+	pq, err := newQueue(less, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return pq
+}
+
+func newQueue(less func(x interface{}, y interface{}) bool, opts ...Option) (*PriorityQueue, error) {
 	pq := &PriorityQueue{
-		s:        newInnerSlice(less),
 		capacity: -1, // infinite capacity by default
+		newBackend: func(less lessFunc) backend {
+			return newInnerSlice(less)
+		},
 	}
 
 	for _, opt := range opts {
 		opt(pq)
 	}
 
-	return pq
+	if pq.radix && pq.capacity > 0 {
+		return nil, ErrRadixHeapWithCapacity
+	}
+
+	// only stable queues pay for wrapping elements with sequence numbers
+	if pq.stable {
+		pq.boxed = true
+	}
+
+	pq.s = pq.newBackend(newElementLessFunc(less, pq.stable, pq.boxed))
+
+	return pq, nil
+}
+
+// boxItems wraps elements into items with sequence numbers even if the queue is not
+// stable, DurableQueue identifies the elements by the sequence numbers.
+func boxItems() Option {
+	return func(pq *PriorityQueue) {
+		pq.boxed = true
+	}
+}
+
+// wrap returns the element stored in backend for x.
+func (pq *PriorityQueue) wrap(x interface{}) interface{} {
+	if !pq.boxed {
+		return x
+	}
+
+	it := &item{value: x, seq: pq.seq}
+	pq.seq++
+	return it
+}
+
+// unwrap returns the element pushed for the element stored in backend.
+func (pq *PriorityQueue) unwrap(x interface{}) interface{} {
+	if !pq.boxed {
+		return x
+	}
+	return x.(*item).value
+}
+
+// elementKey returns the key function of the elements stored in backend.
+func (pq *PriorityQueue) elementKey(key func(x interface{}) uint64) func(x interface{}) uint64 {
+	if !pq.boxed {
+		return key
+	}
+	return func(x interface{}) uint64 {
+		return key(x.(*item).value)
+	}
 }
 
 // Push pushes elements into queue
@@ -47,11 +173,11 @@ func (pq *PriorityQueue) Push(x interface{}) {
 	pq.Lock()
 	defer pq.Unlock()
 
-	heap.Push(pq.s, x)
+	pq.s.push(pq.wrap(x))
 	if pq.capacity > 0 && pq.s.Len() > pq.capacity {
 		// removes and returns the element considered as minimum one from the heap,
 		// if the current size of the queue exceeds the maximum capacity.
-		heap.Pop(pq.s)
+		pq.s.pop()
 	}
 }
 
@@ -60,7 +186,7 @@ func (pq *PriorityQueue) Pop() interface{} {
 	pq.Lock()
 	defer pq.Unlock()
 
-	return heap.Pop(pq.s)
+	return pq.unwrap(pq.s.pop())
 }
 
 // Top accesses the top element (considered as minimum element) from the heap.
@@ -69,7 +195,7 @@ func (pq *PriorityQueue) Top() interface{} {
 	defer pq.RUnlock()
 
 	if pq.s.Len() > 0 {
-		return pq.s.data[0]
+		return pq.unwrap(pq.s.top())
 	}
 	return nil
 }
@@ -86,6 +212,62 @@ func (pq *PriorityQueue) Len() int {
 // should return true if x is considered to go before y.
 type lessFunc func(x interface{}, y interface{}) bool
 
+// item wraps an element with its insertion sequence number, which is used to
+// break ties between equal elements in stable mode.
+type item struct {
+	value interface{}
+	seq   uint64
+}
+
+// newElementLessFunc returns the less function of the elements stored in backend,
+// which are items if boxed.
+func newElementLessFunc(less lessFunc, stable bool, boxed bool) lessFunc {
+	if !boxed {
+		return less
+	}
+
+	if !stable {
+		return func(x interface{}, y interface{}) bool {
+			return less(x.(*item).value, y.(*item).value)
+		}
+	}
+
+	// In stable mode, equal elements are ordered by their insertion sequence number.
+	return func(x interface{}, y interface{}) bool {
+		a, b := x.(*item), y.(*item)
+		if less(a.value, b.value) {
+			return true
+		}
+
+		if less(b.value, a.value) {
+			return false
+		}
+
+		return a.seq < b.seq
+	}
+}
+
+// backend represents the heap implementation behind a priority queue.
+type backend interface {
+	// Len returns the number of elements.
+	Len() int
+	// push pushes an element.
+	push(x interface{})
+	// pop removes and returns the minimum element.
+	pop() interface{}
+	// top returns the minimum element without removing it.
+	top() interface{}
+	// each calls fn for every element in no particular order.
+	each(fn func(x interface{}))
+}
+
+// pushChecker is implemented by the backends that reject some elements on push.
+type pushChecker interface {
+	// checkPush returns an error if x can't be pushed.
+	checkPush(x interface{}) error
+}
+
+// innerSlice is a binary heap maintained by container/heap.
 type innerSlice struct {
 	data []interface{}
 	less lessFunc
@@ -126,6 +308,25 @@ func (s *innerSlice) Push(x interface{}) {
 // Pop removes and returns the element at index s.Len() - 1.
 func (s *innerSlice) Pop() interface{} {
 	res := s.data[s.Len()-1]
+	s.data[s.Len()-1] = nil // avoid memory leak
 	s.data = s.data[:s.Len()-1]
 	return res
 }
+
+func (s *innerSlice) push(x interface{}) {
+	heap.Push(s, x)
+}
+
+func (s *innerSlice) pop() interface{} {
+	return heap.Pop(s)
+}
+
+func (s *innerSlice) top() interface{} {
+	return s.data[0]
+}
+
+func (s *innerSlice) each(fn func(x interface{})) {
+	for _, x := range s.data {
+		fn(x)
+	}
+}
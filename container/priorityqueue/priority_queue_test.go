@@ -66,3 +66,44 @@ func BenchmarkPriorityQueue_Push_WithCapcityLimit(b *testing.B) {
 		queue.Push(i)
 	}
 }
+
+func TestPriorityQueue_Stable(t *testing.T) {
+	type job struct {
+		priority int
+		id       int
+	}
+
+	queue := New(func(x, y interface{}) bool {
+		return x.(job).priority < y.(job).priority
+	}, SetStable())
+
+	for i := 0; i < 100; i++ {
+		queue.Push(job{priority: i % 3, id: i})
+	}
+
+	last := job{priority: -1, id: -1}
+	for queue.Len() > 0 {
+		j := queue.Pop().(job)
+		if j.priority < last.priority {
+			t.Fatalf("priority %v popped after %v", j.priority, last.priority)
+		}
+		if j.priority == last.priority && j.id < last.id {
+			t.Fatalf("job %v with priority %v popped after job %v", j.id, j.priority, last.id)
+		}
+		last = j
+	}
+}
+
+func TestPriorityQueue_PushAllocs(t *testing.T) {
+	queue := New(func(x, y interface{}) bool {
+		return x.(int) < y.(int)
+	}, SetCapacity(10))
+
+	// only stable queues wrap the elements, small ints are boxed without allocation
+	allocs := testing.AllocsPerRun(1000, func() {
+		queue.Push(1)
+	})
+	if allocs != 0 {
+		t.Fatalf("push should not allocate, but got %v allocs", allocs)
+	}
+}
@@ -0,0 +1,135 @@
+package priorityqueue
+
+import (
+	"math/bits"
+	"sort"
+)
+
+type radixItem struct {
+	value interface{}
+	key   uint64
+	seq   uint64 // insertion order, which breaks ties in stable mode
+}
+
+// radixHeap is a monotone radix heap for integer keys. Element with key k is kept in
+// the bucket indexed by the position of the highest bit in which k differs from the
+// last popped key, so bucket 0 holds the elements equal to the last popped key.
+type radixHeap struct {
+	buckets [65][]radixItem
+	last    uint64 // key of the last popped element
+	size    int
+	seq     uint64 // insertion sequence number of the next pushed element
+	key     func(x interface{}) uint64
+	stable  bool
+}
+
+func newRadixHeap(key func(x interface{}) uint64, stable bool) *radixHeap {
+	return &radixHeap{
+		key:    key,
+		stable: stable,
+	}
+}
+
+// Len returns the number of elements.
+func (h *radixHeap) Len() int {
+	return h.size
+}
+
+// checkPush returns ErrRadixHeapKey if x can't be pushed, since its key is less than
+// the key of the last popped element.
+func (h *radixHeap) checkPush(x interface{}) error {
+	if h.key(x) < h.last {
+		return ErrRadixHeapKey
+	}
+	return nil
+}
+
+func (h *radixHeap) push(x interface{}) {
+	k := h.key(x)
+	if k < h.last {
+		panic(ErrRadixHeapKey)
+	}
+
+	b := h.bucket(k)
+	h.buckets[b] = append(h.buckets[b], radixItem{value: x, key: k, seq: h.seq})
+	h.seq++
+	h.size++
+}
+
+func (h *radixHeap) pop() interface{} {
+	if len(h.buckets[0]) == 0 {
+		h.redistribute()
+	}
+
+	res := h.buckets[0][0]
+	h.buckets[0][0] = radixItem{} // avoid memory leak
+	h.buckets[0] = h.buckets[0][1:]
+	if len(h.buckets[0]) == 0 {
+		// release the backing array, whose popped slots are never reused
+		h.buckets[0] = nil
+	}
+	h.size--
+	return res.value
+}
+
+func (h *radixHeap) top() interface{} {
+	if len(h.buckets[0]) > 0 {
+		return h.buckets[0][0].value
+	}
+
+	b := h.firstNonEmptyBucket()
+	return h.buckets[b][h.minIndex(b)].value
+}
+
+func (h *radixHeap) each(fn func(x interface{})) {
+	for _, bucket := range h.buckets {
+		for _, x := range bucket {
+			fn(x.value)
+		}
+	}
+}
+
+func (h *radixHeap) bucket(k uint64) int {
+	return bits.Len64(k ^ h.last)
+}
+
+func (h *radixHeap) firstNonEmptyBucket() int {
+	b := 1
+	for len(h.buckets[b]) == 0 {
+		b++
+	}
+	return b
+}
+
+// minIndex returns the index of the minimum element in bucket b.
+func (h *radixHeap) minIndex(b int) int {
+	min := 0
+	for i, x := range h.buckets[b] {
+		m := h.buckets[b][min]
+		if x.key < m.key || (x.key == m.key && x.seq < m.seq) {
+			min = i
+		}
+	}
+	return min
+}
+
+// redistribute moves the elements of the first non-empty bucket into lower buckets
+// after advancing the last key to the minimum key among them, which fills bucket 0.
+func (h *radixHeap) redistribute() {
+	b := h.firstNonEmptyBucket()
+	h.last = h.buckets[b][h.minIndex(b)].key
+
+	items := h.buckets[b]
+	h.buckets[b] = nil
+	for _, x := range items {
+		nb := h.bucket(x.key)
+		h.buckets[nb] = append(h.buckets[nb], x)
+	}
+
+	if h.stable {
+		bucket := h.buckets[0]
+		sort.Slice(bucket, func(i, j int) bool {
+			return bucket[i].seq < bucket[j].seq
+		})
+	}
+}
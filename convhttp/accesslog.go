@@ -0,0 +1,366 @@
+package convhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jiandahao/goutils/logger"
+	"go.uber.org/zap"
+)
+
+// redacted replaces the redacted values, it needs no escaping in URLs.
+const redacted = "REDACTED"
+
+// AccessLogConfig configs the access log of requests, see WithAccessLog.
+type AccessLogConfig struct {
+	// Logger logs the requests through logger.Logger instead of the zap logger of
+	// WithLogger, the fields are added with WithField.
+	Logger logger.Logger
+	// RedactHeaders are the headers whose values are redacted, case-insensitively,
+	// "Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie" and "X-Api-Key"
+	// by default.
+	RedactHeaders []string
+	// RedactQuery are the query parameters whose values are redacted in URLs, and the
+	// fields whose values are redacted in form bodies, "client_secret", "password",
+	// "access_token" and "refresh_token" by default.
+	RedactQuery []string
+	// RedactJSONPaths are the dot separated paths of fields redacted in JSON bodies, such
+	// as "user.password". "*" matches any key or array element, and the paths go through
+	// arrays implicitly, for example, "items.secret" redacts "secret" of all the items.
+	RedactJSONPaths []string
+	// LogHeaders logs the request and response headers.
+	LogHeaders bool
+	// LogRequestBody logs the request bodies, the multipart files are not logged.
+	LogRequestBody bool
+	// LogResponseBody logs the response bodies, the bodies of streaming responses are not logged.
+	LogResponseBody bool
+	// MaxBodySize truncates the logged bodies to the size in bytes, 1024 by default.
+	MaxBodySize int
+}
+
+// WithAccessLog returns a ClientOption that configs the access log of requests. Each
+// request is logged once with its method, URL, status, duration, sizes, number of
+// attempts and error, and the metadata within context, see logger.AppendMetadata. The
+// requests are logged with the zap logger of WithLogger unless config.Logger is set.
+func WithAccessLog(config AccessLogConfig) ClientOption {
+	return func(c *Client) {
+		config.withDefaults()
+		c.accessLog = &config
+	}
+}
+
+func (config *AccessLogConfig) withDefaults() {
+	if config.RedactHeaders == nil {
+		config.RedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+	}
+	if config.RedactQuery == nil {
+		config.RedactQuery = []string{"client_secret", "password", "access_token", "refresh_token"}
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1024
+	}
+}
+
+// defaultAccessLog is the access log config for clients without WithAccessLog.
+var defaultAccessLog = func() *AccessLogConfig {
+	config := &AccessLogConfig{}
+	config.withDefaults()
+	return config
+}()
+
+func (c *Client) accessLogConfig() *AccessLogConfig {
+	if c.accessLog == nil {
+		return defaultAccessLog
+	}
+	return c.accessLog
+}
+
+// logAccess logs the request and its response.
+func (c *Client) logAccess(ctx context.Context, opts *RequestOptions, resp *Response, start time.Time) {
+	config := c.accessLogConfig()
+	if config.Logger == nil && c.Logger == nil {
+		return
+	}
+
+	fields := []accessLogField{
+		{"method", opts.Method},
+		{"url", config.redactURL(opts.URL, opts.Query)},
+		{"status", resp.statusCode()},
+		{"duration", time.Since(start)},
+		{"attempts", resp.Attempts},
+	}
+
+	if resp.Response != nil && resp.Response.Request != nil && resp.Response.Request.ContentLength >= 0 {
+		fields = append(fields, accessLogField{"request_size", resp.Response.Request.ContentLength})
+	}
+	if resp.Response != nil {
+		size := int64(len(resp.Body))
+		if resp.stream != nil {
+			size = resp.ContentLength
+		}
+		if size >= 0 {
+			fields = append(fields, accessLogField{"response_size", size})
+		}
+	}
+
+	if opts.throttle.Waited > 0 || opts.throttle.Rejected {
+		fields = append(fields, accessLogField{"throttle_wait", opts.throttle.Waited})
+	}
+
+	if config.LogHeaders {
+		fields = append(fields, accessLogField{"request_header", config.redactHeader(opts.Header)})
+		if resp.Response != nil {
+			fields = append(fields, accessLogField{"response_header", config.redactHeader(resp.Header)})
+		}
+	}
+
+	if config.LogRequestBody && opts.Request != nil {
+		fields = append(fields, accessLogField{"request_body", config.formatBody(config.requestBody(opts))})
+	}
+	if config.LogResponseBody && resp.Response != nil && resp.stream == nil {
+		fields = append(fields, accessLogField{"response_body", config.formatBody(resp.Body)})
+	}
+
+	if resp.err != nil {
+		fields = append(fields, accessLogField{"error", config.redactError(resp.err, opts)})
+	}
+
+	if config.Logger != nil {
+		l := config.Logger
+		for _, field := range fields {
+			if d, ok := field.value.(time.Duration); ok {
+				// logger.Logger reflects the values, which shows durations in nanoseconds
+				field.value = d.String()
+			}
+			l = l.WithField(field.key, field.value)
+		}
+
+		if resp.err != nil {
+			l.Errorf(ctx, "handle request")
+		} else {
+			l.Infof(ctx, "handle request")
+		}
+		return
+	}
+
+	zapFields := metadataFields(ctx)
+	for _, field := range fields {
+		zapFields = append(zapFields, zap.Any(field.key, field.value))
+	}
+
+	if resp.err != nil {
+		c.Logger.Error("handle request", zapFields...)
+		return
+	}
+	c.Logger.Info("handle request", zapFields...)
+}
+
+type accessLogField struct {
+	key   string
+	value interface{}
+}
+
+// requestBody returns the request body encoded for logging, with the redacted form
+// fields replaced.
+func (config *AccessLogConfig) requestBody(opts *RequestOptions) []byte {
+	switch body := opts.Request.(type) {
+	case []byte:
+		return body
+	case string:
+		return []byte(body)
+	case *FormData:
+		// the files are logged by their names only
+		form := &FormData{Values: config.redactValues(body.Values), files: body.files}
+		data, _ := form.MarshalJSON()
+		return data
+	}
+
+	if encoder := opts.encoder(); encoder != nil {
+		data, err := encoder.Encode(opts.Request)
+		if err != nil {
+			return nil
+		}
+		return data
+	}
+
+	data, _ := json.Marshal(opts.Request)
+	return data
+}
+
+// redactURL returns rawURL with the query, the password and the redacted query values replaced.
+func (config *AccessLogConfig) redactURL(rawURL string, query url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+
+	if len(query) == 0 {
+		// the query of request is replaced by RequestOptions.Query
+		u.RawQuery = ""
+		return u.String()
+	}
+
+	u.RawQuery = config.redactValues(query).Encode()
+
+	return u.String()
+}
+
+// redactValues returns a copy of values with the values of RedactQuery keys replaced.
+func (config *AccessLogConfig) redactValues(values url.Values) url.Values {
+	if values == nil {
+		return nil
+	}
+
+	redactedValues := make(url.Values, len(values))
+	for key, vs := range values {
+		redactedValues[key] = vs
+		for _, k := range config.RedactQuery {
+			if key == k {
+				redactedValues[key] = []string{redacted}
+				break
+			}
+		}
+	}
+
+	return redactedValues
+}
+
+// redactError returns the text of err with the URLs of request replaced by the redacted
+// one, since errors such as *HTTPError and *url.Error contain the URLs.
+func (config *AccessLogConfig) redactError(err error, opts *RequestOptions) string {
+	text := err.Error()
+
+	u, parseErr := url.Parse(opts.URL)
+	if parseErr != nil {
+		return text
+	}
+	redactedURL := config.redactURL(opts.URL, opts.Query)
+
+	// the URL sent, and the one with the password masked by http client
+	u.RawQuery = opts.Query.Encode()
+	urls := []string{u.String()}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "***")
+		urls = append(urls, u.String())
+	}
+	urls = append(urls, opts.URL)
+
+	// the longer URLs go first, so that they're not replaced partially by their prefixes
+	sort.Slice(urls, func(i, j int) bool { return len(urls[i]) > len(urls[j]) })
+
+	var oldnew []string
+	for _, rawURL := range urls {
+		if rawURL != "" {
+			oldnew = append(oldnew, rawURL, redactedURL)
+		}
+	}
+
+	return strings.NewReplacer(oldnew...).Replace(text)
+}
+
+// redactHeader returns a copy of header with the redacted values replaced.
+func (config *AccessLogConfig) redactHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+
+	h := header.Clone()
+	for _, key := range config.RedactHeaders {
+		if _, ok := h[http.CanonicalHeaderKey(key)]; ok {
+			h.Set(key, redacted)
+		}
+	}
+
+	return h
+}
+
+// formatBody redacts the JSON body, and truncates it to MaxBodySize.
+func (config *AccessLogConfig) formatBody(body []byte) string {
+	if len(config.RedactJSONPaths) > 0 && json.Valid(body) {
+		body = redactJSON(body, config.RedactJSONPaths)
+	}
+
+	if len(body) <= config.MaxBodySize {
+		return string(body)
+	}
+
+	truncated := truncateUTF8(body, config.MaxBodySize)
+	return fmt.Sprintf("%s...(%d bytes truncated)", truncated, len(body)-len(truncated))
+}
+
+// redactJSON replaces the values at paths in JSON data.
+func redactJSON(data []byte, paths []string) []byte {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return data
+	}
+
+	for _, p := range paths {
+		v = redactPath(v, strings.Split(p, "."))
+	}
+
+	redactedData, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return redactedData
+}
+
+func redactPath(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return redacted
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if path[0] == "*" || path[0] == key {
+				value[key] = redactPath(child, path[1:])
+			}
+		}
+	case []interface{}:
+		rest := path
+		if path[0] == "*" {
+			rest = path[1:]
+		}
+		for i, child := range value {
+			value[i] = redactPath(child, rest)
+		}
+	}
+
+	return v
+}
+
+// truncateUTF8 truncates data to at most size bytes, without cutting a multi-byte
+// character in the middle.
+func truncateUTF8(data []byte, size int) []byte {
+	if len(data) <= size {
+		return data
+	}
+
+	data = data[:size]
+	for len(data) > 0 && !utf8.Valid(data) {
+		r, _ := utf8.DecodeLastRune(data)
+		if r != utf8.RuneError {
+			break
+		}
+		data = data[:len(data)-1]
+	}
+
+	return data
+}
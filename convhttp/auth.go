@@ -0,0 +1,388 @@
+package convhttp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BearerToken returns a RequestInterceptor that sets the Authorization header with the
+// static bearer token.
+func BearerToken(token string) RequestInterceptor {
+	return func(opts *RequestOptions) {
+		setHeader(opts, "Authorization", "Bearer "+token)
+	}
+}
+
+// BasicAuth returns a RequestInterceptor that sets the Authorization header with the
+// username and password.
+func BasicAuth(username string, password string) RequestInterceptor {
+	return func(opts *RequestOptions) {
+		setHeader(opts, "Authorization", basicAuthHeader(username, password))
+	}
+}
+
+func setHeader(opts *RequestOptions, key string, value string) {
+	if opts.Header == nil {
+		opts.Header = http.Header{}
+	}
+	opts.Header.Set(key, value)
+}
+
+// HMACConfig configs the HMAC request signing, see HMACSigner.
+type HMACConfig struct {
+	// KeyID identifies the secret, it's sent in KeyIDHeader if it's not empty.
+	KeyID string
+	// Secret is the key of HMAC.
+	Secret []byte
+	// Hash is the hash function of HMAC, sha256.New by default.
+	Hash func() hash.Hash
+	// SignatureHeader is the header of the hex encoded signature, "X-Signature" by default.
+	SignatureHeader string
+	// TimestampHeader is the header of the unix timestamp in seconds, "X-Timestamp" by default.
+	TimestampHeader string
+	// KeyIDHeader is the header of KeyID, "X-Key-Id" by default.
+	KeyIDHeader string
+	// Now returns the current time, time.Now by default.
+	Now func() time.Time
+}
+
+func (config *HMACConfig) withDefaults() {
+	if config.Hash == nil {
+		config.Hash = sha256.New
+	}
+	if config.SignatureHeader == "" {
+		config.SignatureHeader = "X-Signature"
+	}
+	if config.TimestampHeader == "" {
+		config.TimestampHeader = "X-Timestamp"
+	}
+	if config.KeyIDHeader == "" {
+		config.KeyIDHeader = "X-Key-Id"
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+}
+
+// HMACSigner returns a RequestInterceptor that signs the requests with HMAC over the
+// string to sign, see HMACConfig.Sign. The request body is encoded and buffered in
+// memory for signing, including the multipart form data. The signature is computed once
+// for all the retries of a request, so that the servers should allow the timestamp to
+// skew by the total time of retries. The request is aborted if the body could not be
+// encoded.
+func HMACSigner(config HMACConfig) RequestInterceptor {
+	config.withDefaults()
+
+	return func(opts *RequestOptions) {
+		body, err := opts.bodyBytes()
+		if err != nil {
+			opts.Abort(fmt.Sprintf("failed to sign request: %v", err))
+			return
+		}
+
+		path := "/"
+		if u, err := url.Parse(opts.URL); err == nil && u.EscapedPath() != "" {
+			path = u.EscapedPath()
+		}
+
+		method := opts.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+
+		timestamp := strconv.FormatInt(config.Now().Unix(), 10)
+		setHeader(opts, config.TimestampHeader, timestamp)
+		if config.KeyID != "" {
+			opts.Header.Set(config.KeyIDHeader, config.KeyID)
+		}
+		opts.Header.Set(config.SignatureHeader, config.Sign(method, path, opts.Query, body, timestamp))
+	}
+}
+
+// Sign returns the hex encoded HMAC signature of the string to sign, which is the lines
+// of method, escaped path, canonical query sorted by keys and values, hex encoded
+// SHA-256 hash of body, and timestamp, joined by "\n". Servers verify the requests by
+// comparing the signature with hmac.Equal.
+func (config HMACConfig) Sign(method string, path string, query url.Values, body []byte, timestamp string) string {
+	config.withDefaults()
+
+	bodyHash := sha256.Sum256(body)
+	stringToSign := strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		canonicalQuery(query),
+		hex.EncodeToString(bodyHash[:]),
+		timestamp,
+	}, "\n")
+
+	mac := hmac.New(config.Hash, config.Secret)
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalQuery encodes query sorted by keys and values.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// OAuth2Config configs the OAuth2 client credentials grant, see OAuth2ClientCredentials.
+type OAuth2Config struct {
+	// TokenURL is the token endpoint of the authorization server.
+	TokenURL string
+	// ClientID is the client identifier.
+	ClientID string
+	// ClientSecret is the client secret.
+	ClientSecret string
+	// Scopes are the requested scopes.
+	Scopes []string
+	// EndpointParams are the additional parameters of token requests, such as "audience".
+	EndpointParams url.Values
+	// AuthInParams sends the client credentials in the request body, instead of the
+	// Authorization header with basic auth.
+	AuthInParams bool
+	// RefreshBefore refreshes the token the duration before it expires, 1 minute by default.
+	RefreshBefore time.Duration
+	// Client sends the token requests, a new client without options by default.
+	Client *Client
+}
+
+// OAuth2Token is an access token.
+type OAuth2Token struct {
+	AccessToken string
+	TokenType   string
+	// Expiry is the time when the token expires, zero means it never expires.
+	Expiry time.Time
+}
+
+// OAuth2TokenSource gets access tokens with the client credentials grant, and caches
+// them until RefreshBefore their expiry.
+type OAuth2TokenSource struct {
+	config OAuth2Config
+
+	mu      sync.Mutex
+	token   *OAuth2Token
+	refresh *tokenRefresh // the in-flight token request
+}
+
+// tokenRefresh is a token request shared by the callers of Token.
+type tokenRefresh struct {
+	done    chan struct{} // closed once token and err are set
+	token   *OAuth2Token
+	err     error
+	waiters int // guarded by the mutex of OAuth2TokenSource
+	cancel  context.CancelFunc
+}
+
+// NewOAuth2TokenSource returns an OAuth2TokenSource.
+func NewOAuth2TokenSource(config OAuth2Config) *OAuth2TokenSource {
+	if config.RefreshBefore <= 0 {
+		config.RefreshBefore = time.Minute
+	}
+	if config.Client == nil {
+		config.Client = NewClient()
+	}
+
+	return &OAuth2TokenSource{config: config}
+}
+
+// OAuth2ClientCredentials returns a RequestInterceptor that sets the Authorization
+// header with the access tokens of NewOAuth2TokenSource(config).
+func OAuth2ClientCredentials(config OAuth2Config) RequestInterceptor {
+	return NewOAuth2TokenSource(config).Interceptor()
+}
+
+// Interceptor returns a RequestInterceptor that sets the Authorization header with the
+// access tokens. The request is aborted if the token could not be got.
+func (s *OAuth2TokenSource) Interceptor() RequestInterceptor {
+	return func(opts *RequestOptions) {
+		token, err := s.Token(opts.Context())
+		if err != nil {
+			opts.Abort(err.Error())
+			return
+		}
+
+		tokenType := token.TokenType
+		if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+			tokenType = "Bearer"
+		}
+		setHeader(opts, "Authorization", tokenType+" "+token.AccessToken)
+	}
+}
+
+// Token returns the cached token, or requests a new one if there isn't one or it's
+// about to expire. Concurrent callers wait for the same token request, each of them
+// gives up once its own ctx is done, and the request is canceled once all of them
+// have given up.
+func (s *OAuth2TokenSource) Token(ctx context.Context) (*OAuth2Token, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s.mu.Lock()
+	if s.token != nil && (s.token.Expiry.IsZero() || time.Now().Add(s.config.RefreshBefore).Before(s.token.Expiry)) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+
+	refresh := s.refresh
+	if refresh == nil {
+		// the request outlives the caller starting it, but keeps the values of its ctx
+		refreshCtx, cancel := context.WithCancel(valueContext{ctx})
+		refresh = &tokenRefresh{done: make(chan struct{}), cancel: cancel}
+		s.refresh = refresh
+		go s.doRefresh(refreshCtx, refresh)
+	}
+	refresh.waiters++
+	s.mu.Unlock()
+
+	select {
+	case <-refresh.done:
+		return refresh.token, refresh.err
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	refresh.waiters--
+	if refresh.waiters == 0 && s.refresh == refresh {
+		// nobody waits for the token any more, the next caller starts a new request
+		s.refresh = nil
+		refresh.cancel()
+	}
+	s.mu.Unlock()
+
+	return nil, fmt.Errorf("oauth2: failed to get token: %w", ctx.Err())
+}
+
+func (s *OAuth2TokenSource) doRefresh(ctx context.Context, refresh *tokenRefresh) {
+	token, err := s.requestToken(ctx)
+	refresh.cancel()
+
+	s.mu.Lock()
+	if s.refresh == refresh {
+		s.refresh = nil
+		if err == nil {
+			s.token = token
+		}
+	}
+	refresh.token, refresh.err = token, err
+	s.mu.Unlock()
+
+	close(refresh.done)
+}
+
+// valueContext keeps the values of Context, such as the metadata for logging, without
+// its deadline and cancellation.
+type valueContext struct {
+	context.Context
+}
+
+func (valueContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (valueContext) Done() <-chan struct{}       { return nil }
+func (valueContext) Err() error                  { return nil }
+
+// Invalidate drops the cached token, so that the next call of Token requests a new one,
+// for example, after the server rejected the token with 401. The token of an in-flight
+// request is still cached once it's got, since it's newer than the rejected one.
+func (s *OAuth2TokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = nil
+}
+
+type oauth2TokenResponse struct {
+	AccessToken      string          `json:"access_token"`
+	TokenType        string          `json:"token_type"`
+	ExpiresIn        json.RawMessage `json:"expires_in"`
+	Error            string          `json:"error"`
+	ErrorDescription string          `json:"error_description"`
+}
+
+func (s *OAuth2TokenSource) requestToken(ctx context.Context) (*OAuth2Token, error) {
+	form := NewFormData()
+	form.Set("grant_type", "client_credentials")
+	if len(s.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+	for key, values := range s.config.EndpointParams {
+		for _, value := range values {
+			form.Add(key, value)
+		}
+	}
+
+	builder := s.config.Client.NewRequest(http.MethodPost, s.config.TokenURL).
+		Context(ctx).
+		Header("Accept", "application/json")
+
+	if s.config.AuthInParams {
+		form.Set("client_id", s.config.ClientID)
+		form.Set("client_secret", s.config.ClientSecret)
+	} else {
+		// the credentials are form-urlencoded before basic auth, see RFC 6749 section 2.3.1
+		builder.Header("Authorization", basicAuthHeader(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret)))
+	}
+
+	start := time.Now()
+	resp := builder.Body(form).Do()
+	if resp.err != nil {
+		return nil, fmt.Errorf("oauth2: failed to request token: %w", resp.err)
+	}
+
+	var tr oauth2TokenResponse
+	_ = json.Unmarshal(resp.Body, &tr)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || tr.Error != "" {
+		if tr.Error != "" {
+			return nil, fmt.Errorf("oauth2: token request failed with %s: %s %s", resp.Status, tr.Error, tr.ErrorDescription)
+		}
+		return nil, fmt.Errorf("oauth2: token request failed: %w", newHTTPError(resp))
+	}
+
+	if tr.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2: server response missing access_token")
+	}
+
+	token := &OAuth2Token{AccessToken: tr.AccessToken, TokenType: tr.TokenType}
+
+	// some servers send expires_in as a string
+	expiresIn := strings.Trim(string(tr.ExpiresIn), `"`)
+	if seconds, err := strconv.ParseInt(expiresIn, 10, 64); err == nil && seconds > 0 {
+		token.Expiry = start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	return token, nil
+}
+
+func basicAuthHeader(username string, password string) string {
+	req := &http.Request{Header: http.Header{}}
+	req.SetBasicAuth(username, password)
+	return req.Header.Get("Authorization")
+}
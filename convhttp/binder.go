@@ -1,6 +1,19 @@
 package convhttp
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
 
 // Binder binder
 type Binder interface {
@@ -10,6 +23,14 @@ type Binder interface {
 	Bind(data []byte, obj interface{}) error
 }
 
+// Encoder encodes request bodies, see WithEncoder.
+type Encoder interface {
+	// ContentType returns the Content-Type of the encoded data.
+	ContentType() string
+	// Encode encodes obj.
+	Encode(obj interface{}) ([]byte, error)
+}
+
 // JSONBinder json binder
 type JSONBinder struct{}
 
@@ -22,3 +43,444 @@ func (b *JSONBinder) Name() string {
 func (b *JSONBinder) Bind(data []byte, obj interface{}) error {
 	return json.Unmarshal(data, obj)
 }
+
+// ContentType returns "application/json".
+func (b *JSONBinder) ContentType() string {
+	return "application/json"
+}
+
+// Encode encodes obj as JSON.
+func (b *JSONBinder) Encode(obj interface{}) ([]byte, error) {
+	return json.Marshal(obj)
+}
+
+// XMLBinder xml binder
+type XMLBinder struct{}
+
+// Name returns the binding engine name
+func (b *XMLBinder) Name() string {
+	return "xml_binder"
+}
+
+// Bind binds the passed struct pointer using xml binding engine.
+func (b *XMLBinder) Bind(data []byte, obj interface{}) error {
+	return xml.Unmarshal(data, obj)
+}
+
+// ContentType returns "application/xml".
+func (b *XMLBinder) ContentType() string {
+	return "application/xml"
+}
+
+// Encode encodes obj as XML.
+func (b *XMLBinder) Encode(obj interface{}) ([]byte, error) {
+	return xml.Marshal(obj)
+}
+
+// YAMLBinder yaml binder
+type YAMLBinder struct{}
+
+// Name returns the binding engine name
+func (b *YAMLBinder) Name() string {
+	return "yaml_binder"
+}
+
+// Bind binds the passed struct pointer using yaml binding engine.
+func (b *YAMLBinder) Bind(data []byte, obj interface{}) error {
+	return yaml.Unmarshal(data, obj)
+}
+
+// ContentType returns "application/x-yaml".
+func (b *YAMLBinder) ContentType() string {
+	return "application/x-yaml"
+}
+
+// Encode encodes obj as YAML.
+func (b *YAMLBinder) Encode(obj interface{}) ([]byte, error) {
+	return yaml.Marshal(obj)
+}
+
+// MsgpackBinder msgpack binder
+type MsgpackBinder struct{}
+
+var msgpackHandle = &codec.MsgpackHandle{}
+
+// Name returns the binding engine name
+func (b *MsgpackBinder) Name() string {
+	return "msgpack_binder"
+}
+
+// Bind binds the passed struct pointer using msgpack binding engine.
+func (b *MsgpackBinder) Bind(data []byte, obj interface{}) error {
+	return codec.NewDecoderBytes(data, msgpackHandle).Decode(obj)
+}
+
+// ContentType returns "application/msgpack".
+func (b *MsgpackBinder) ContentType() string {
+	return "application/msgpack"
+}
+
+// Encode encodes obj as msgpack.
+func (b *MsgpackBinder) Encode(obj interface{}) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(obj)
+	return data, err
+}
+
+// ProtobufBinder protobuf binder, the objects must be proto.Message.
+type ProtobufBinder struct{}
+
+// Name returns the binding engine name
+func (b *ProtobufBinder) Name() string {
+	return "protobuf_binder"
+}
+
+// Bind binds the passed proto.Message using protobuf binding engine.
+func (b *ProtobufBinder) Bind(data []byte, obj interface{}) error {
+	msg, ok := obj.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a proto.Message", obj)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// ContentType returns "application/x-protobuf".
+func (b *ProtobufBinder) ContentType() string {
+	return "application/x-protobuf"
+}
+
+// Encode encodes obj as protobuf.
+func (b *ProtobufBinder) Encode(obj interface{}) ([]byte, error) {
+	msg, ok := obj.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto.Message", obj)
+	}
+	return proto.Marshal(msg)
+}
+
+// FormBinder url-encoded form binder. The objects could be url.Values, map[string]string,
+// map[string][]string, or structs whose fields are mapped by the "form" tags, fields
+// without the tag are mapped by their names, and fields tagged with "-" are skipped.
+// The fields could be strings, bools, numbers, or slices of them.
+type FormBinder struct{}
+
+// Name returns the binding engine name
+func (b *FormBinder) Name() string {
+	return "form_binder"
+}
+
+// Bind binds the passed struct pointer using form binding engine.
+func (b *FormBinder) Bind(data []byte, obj interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	return decodeForm(values, obj)
+}
+
+// ContentType returns "application/x-www-form-urlencoded".
+func (b *FormBinder) ContentType() string {
+	return "application/x-www-form-urlencoded"
+}
+
+// Encode encodes obj as url-encoded form.
+func (b *FormBinder) Encode(obj interface{}) ([]byte, error) {
+	values, err := encodeForm(obj)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(values.Encode()), nil
+}
+
+// BinderForContentType returns the binder for the media type of contentType, it
+// returns false if there isn't.
+func BinderForContentType(contentType string) (Binder, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return &JSONBinder{}, true
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return &XMLBinder{}, true
+	case mediaType == "application/x-www-form-urlencoded":
+		return &FormBinder{}, true
+	case mediaType == "application/x-yaml" || mediaType == "application/yaml" || mediaType == "text/yaml":
+		return &YAMLBinder{}, true
+	case mediaType == "application/msgpack" || mediaType == "application/x-msgpack":
+		return &MsgpackBinder{}, true
+	case mediaType == "application/x-protobuf" || mediaType == "application/protobuf":
+		return &ProtobufBinder{}, true
+	default:
+		return nil, false
+	}
+}
+
+// ShouldBind binds the response body with the binder for the Content-Type of response,
+// JSON is assumed if the response has no Content-Type.
+func (resp *Response) ShouldBind(obj interface{}) error {
+	if resp.err != nil {
+		return resp.err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		return resp.ShouldBindJSON(obj)
+	}
+
+	binder, ok := BinderForContentType(contentType)
+	if !ok {
+		resp.err = fmt.Errorf("no binder for content type %s", contentType)
+		return resp.err
+	}
+
+	return resp.ShouldBindWith(obj, binder)
+}
+
+// encodeForm encodes url.Values, maps or structs into url.Values.
+func encodeForm(obj interface{}) (url.Values, error) {
+	switch v := obj.(type) {
+	case url.Values:
+		return v, nil
+	case map[string][]string:
+		return url.Values(v), nil
+	case map[string]string:
+		values := url.Values{}
+		for key, value := range v {
+			values.Set(key, value)
+		}
+		return values, nil
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(obj))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("could not encode %T as form", obj)
+	}
+
+	values := url.Values{}
+	if err := encodeFormStruct(rv, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func encodeFormStruct(rv reflect.Value, values url.Values) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if field.Anonymous && reflect.Indirect(fv).Kind() == reflect.Struct {
+			if fv.Kind() == reflect.Ptr && fv.IsNil() {
+				continue
+			}
+			if err := encodeFormStruct(reflect.Indirect(fv), values); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name, omitempty := formFieldName(field)
+		if name == "-" || (omitempty && fv.IsZero()) {
+			continue
+		}
+
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+
+		if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array {
+			for j := 0; j < fv.Len(); j++ {
+				s, err := formatFormValue(fv.Index(j))
+				if err != nil {
+					return fmt.Errorf("field %s: %w", field.Name, err)
+				}
+				values.Add(name, s)
+			}
+			continue
+		}
+
+		s, err := formatFormValue(fv)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		values.Set(name, s)
+	}
+
+	return nil
+}
+
+// decodeForm decodes values into obj, a pointer to url.Values, map or struct.
+func decodeForm(values url.Values, obj interface{}) error {
+	switch v := obj.(type) {
+	case *url.Values:
+		*v = values
+		return nil
+	case *map[string][]string:
+		*v = values
+		return nil
+	case *map[string]string:
+		if *v == nil {
+			*v = make(map[string]string, len(values))
+		}
+		for key := range values {
+			(*v)[key] = values.Get(key)
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("could not decode form into %T", obj)
+	}
+
+	return decodeFormStruct(values, rv.Elem())
+}
+
+func decodeFormStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if field.Anonymous {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if fv.Kind() == reflect.Ptr {
+					if fv.IsNil() {
+						if !fv.CanSet() {
+							// an unexported nil pointer can't be allocated, as encoding/json does
+							continue
+						}
+						fv.Set(reflect.New(ft))
+					}
+					fv = fv.Elem()
+				}
+				if err := decodeFormStruct(values, fv); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if field.PkgPath != "" {
+				// unexported embedded non-struct types
+				continue
+			}
+		}
+
+		name, _ := formFieldName(field)
+		vs, ok := values[name]
+		if name == "-" || !ok || len(vs) == 0 {
+			continue
+		}
+
+		if fv.Kind() == reflect.Ptr {
+			fv.Set(reflect.New(fv.Type().Elem()))
+			fv = fv.Elem()
+		}
+
+		if fv.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(fv.Type(), len(vs), len(vs))
+			for j, s := range vs {
+				if err := parseFormValue(s, slice.Index(j)); err != nil {
+					return fmt.Errorf("field %s: %w", field.Name, err)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+
+		if err := parseFormValue(vs[0], fv); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// formFieldName returns the form name of the field, and whether it has omitempty option.
+func formFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("form")
+	if tag == "" {
+		return field.Name, false
+	}
+
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			return name, true
+		}
+	}
+	return name, false
+}
+
+func formatFormValue(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	default:
+		return "", fmt.Errorf("unsupported type %v", v.Type())
+	}
+}
+
+func parseFormValue(s string, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+
+	return nil
+}
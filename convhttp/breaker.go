@@ -0,0 +1,329 @@
+package convhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jiandahao/goutils/metric"
+)
+
+// ErrCircuitOpen is returned without sending the request when the circuit breaker of
+// the upstream host is open.
+var ErrCircuitOpen = errors.New("convhttp: circuit breaker is open")
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets requests through, and counts the failures.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails requests fast until OpenTimeout elapses.
+	BreakerOpen
+	// BreakerHalfOpen lets a limited number of probe requests through, the breaker is
+	// closed if they all succeed, and opened again once any of them fails.
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// CircuitBreakerConfig configs the circuit breakers. The zero value of a field means
+// its default value, and a negative threshold disables the threshold.
+type CircuitBreakerConfig struct {
+	// Name is the client label of the metrics, "default" by default.
+	Name string
+	// ConsecutiveFailures opens the breaker after the number of consecutive failures, 5 by default.
+	ConsecutiveFailures int
+	// FailureRatio opens the breaker once the ratio of failed requests within Interval
+	// reaches it, and at least MinRequests requests are made, 0.5 by default.
+	FailureRatio float64
+	// MinRequests is the minimum number of requests within Interval for FailureRatio
+	// to take effect, 20 by default.
+	MinRequests int
+	// Interval is the cyclic period to clear the counts of a closed breaker, 60s by default.
+	Interval time.Duration
+	// OpenTimeout is how long an open breaker stays open before turning half-open, 30s by default.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probe requests allowed by a half-open breaker, 1 by default.
+	HalfOpenRequests int
+	// IsFailure reports whether a request failed, errors and 5xx statuses by default.
+	// Requests canceled by their contexts are counted as neither successes nor failures.
+	IsFailure func(resp *Response, err error) bool
+	// OnStateChange is called when the breaker of host changes its state, with the
+	// breaker locked, so it must not block.
+	OnStateChange func(host string, from BreakerState, to BreakerState)
+}
+
+// WithCircuitBreaker returns a ClientOption that enables circuit breakers per upstream
+// host. The state changes are exposed as Prometheus metrics with the metric namespace,
+// see metric.SetNamespace, which should be set before creating the client.
+func WithCircuitBreaker(config CircuitBreakerConfig) ClientOption {
+	return func(c *Client) {
+		c.breakers = newBreakerGroup(config)
+	}
+}
+
+func (config *CircuitBreakerConfig) withDefaults() {
+	if config.Name == "" {
+		config.Name = "default"
+	}
+	if config.ConsecutiveFailures == 0 {
+		config.ConsecutiveFailures = 5
+	}
+	if config.FailureRatio == 0 {
+		config.FailureRatio = 0.5
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 20
+	}
+	if config.Interval <= 0 {
+		config.Interval = 60 * time.Second
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = func(resp *Response, err error) bool {
+			return err != nil || resp.StatusCode >= 500
+		}
+	}
+}
+
+// attempt makes an attempt of the request through the circuit breaker of its host.
+func (c *Client) attempt(opts *RequestOptions) *Response {
+	if c.breakers == nil {
+		return c.do(opts)
+	}
+
+	done, err := c.breakers.get(opts.URL).allow()
+	if err != nil {
+		return &Response{Request: opts, err: err}
+	}
+
+	// the request is released without a result if it panics
+	result := resultIgnored
+	defer func() { done(result) }()
+
+	resp := c.do(opts)
+	switch {
+	case errors.Is(resp.err, context.Canceled):
+		// a canceled request tells nothing about the upstream
+	case c.breakers.config.IsFailure(resp, resp.err):
+		result = resultFailure
+	default:
+		result = resultSuccess
+	}
+
+	return resp
+}
+
+// requestResult is the result of a request reported to the breaker.
+type requestResult int
+
+const (
+	// resultIgnored releases the request without counting it, such as a canceled one.
+	resultIgnored requestResult = iota
+	resultSuccess
+	resultFailure
+)
+
+// breakerGroup holds the circuit breakers of hosts.
+type breakerGroup struct {
+	config    CircuitBreakerConfig
+	collector *metric.CircuitBreakerCollector
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func newBreakerGroup(config CircuitBreakerConfig) *breakerGroup {
+	config.withDefaults()
+
+	return &breakerGroup{
+		config:    config,
+		collector: metric.GetOrRegisterCircuitBreakerCollector(),
+		breakers:  make(map[string]*breaker),
+	}
+}
+
+// get returns the breaker of the host of rawURL.
+func (g *breakerGroup) get(rawURL string) *breaker {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b, ok := g.breakers[host]
+	if !ok {
+		b = &breaker{group: g, host: host}
+		g.breakers[host] = b
+		g.collector.ObserveState(g.config.Name, host, BreakerClosed.String())
+	}
+
+	return b
+}
+
+// BreakerState returns the state of the circuit breaker of host, BreakerClosed if the client
+// has not sent any request to host, or circuit breaker is not enabled.
+func (c *Client) BreakerState(host string) BreakerState {
+	if c.breakers == nil {
+		return BreakerClosed
+	}
+
+	c.breakers.mu.Lock()
+	b, ok := c.breakers.breakers[host]
+	c.breakers.mu.Unlock()
+	if !ok {
+		return BreakerClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.currentState(time.Now())
+}
+
+// breaker is the circuit breaker of a host.
+type breaker struct {
+	group *breakerGroup
+	host  string
+
+	mu                  sync.Mutex
+	state               BreakerState
+	generation          uint64 // increased on every state change and clearing of counts
+	expiry              time.Time
+	requests            int
+	failures            int
+	consecutiveFailures int
+	successes           int // consecutive successes in half-open state
+}
+
+// allow checks whether a request is allowed, and returns the function to report the
+// result, which must be called exactly once.
+func (b *breaker) allow() (func(result requestResult), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	state := b.currentState(now)
+
+	if state == BreakerOpen || (state == BreakerHalfOpen && b.requests >= b.group.config.HalfOpenRequests) {
+		b.group.collector.ObserveRejected(b.group.config.Name, b.host)
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, b.host)
+	}
+
+	b.requests++
+	generation := b.generation
+
+	return func(result requestResult) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		now := time.Now()
+		state := b.currentState(now)
+		if generation != b.generation {
+			// the result of a request made before the state change is stale
+			return
+		}
+
+		switch result {
+		case resultIgnored:
+			// release the request, so that a half-open breaker could make another probe
+			b.requests--
+		case resultFailure:
+			b.onFailure(state, now)
+		default:
+			b.onSuccess(state, now)
+		}
+	}, nil
+}
+
+func (b *breaker) onSuccess(state BreakerState, now time.Time) {
+	b.consecutiveFailures = 0
+
+	if state == BreakerHalfOpen {
+		b.successes++
+		if b.successes >= b.group.config.HalfOpenRequests {
+			b.setState(BreakerClosed, now)
+		}
+	}
+}
+
+func (b *breaker) onFailure(state BreakerState, now time.Time) {
+	if state == BreakerHalfOpen {
+		b.setState(BreakerOpen, now)
+		return
+	}
+
+	b.failures++
+	b.consecutiveFailures++
+
+	config := &b.group.config
+	if (config.ConsecutiveFailures > 0 && b.consecutiveFailures >= config.ConsecutiveFailures) ||
+		(config.FailureRatio > 0 && b.requests >= config.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= config.FailureRatio) {
+		b.setState(BreakerOpen, now)
+	}
+}
+
+// currentState returns the state at now, it turns an open breaker half-open after
+// OpenTimeout, and clears the counts of a closed breaker every Interval.
+func (b *breaker) currentState(now time.Time) BreakerState {
+	switch b.state {
+	case BreakerClosed:
+		if now.After(b.expiry) {
+			b.clear(now)
+		}
+	case BreakerOpen:
+		if now.After(b.expiry) {
+			b.setState(BreakerHalfOpen, now)
+		}
+	}
+
+	return b.state
+}
+
+func (b *breaker) setState(state BreakerState, now time.Time) {
+	from := b.state
+	b.state = state
+	b.clear(now)
+
+	if state == BreakerOpen {
+		b.expiry = now.Add(b.group.config.OpenTimeout)
+	}
+
+	b.group.collector.ObserveStateChange(b.group.config.Name, b.host, from.String(), state.String())
+	if b.group.config.OnStateChange != nil {
+		b.group.config.OnStateChange(b.host, from, state)
+	}
+}
+
+func (b *breaker) clear(now time.Time) {
+	b.generation++
+	b.requests, b.failures, b.consecutiveFailures, b.successes = 0, 0, 0, 0
+
+	if b.state == BreakerClosed {
+		b.expiry = now.Add(b.group.config.Interval)
+	}
+}
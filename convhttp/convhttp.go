@@ -2,7 +2,9 @@ package convhttp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,7 +13,9 @@ import (
 	"net/url"
 	"reflect"
 	"strings"
+	"time"
 
+	"github.com/jiandahao/goutils/logger"
 	"go.uber.org/zap"
 )
 
@@ -22,9 +26,22 @@ type RequestOptions struct {
 	Header  http.Header `json:"header,omitempty"`
 	Query   url.Values  `json:"query,omitempty"`
 	Request interface{} `json:"request,omitempty"`
-
-	aborted       bool
-	abortedReason string
+	// Timeout limits the time of the request, including reading the response body,
+	// zero means no timeout other than the one of the http client.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Stream leaves the response body unread, see Response.Stream.
+	Stream bool `json:"stream,omitempty"`
+	// Encoder encodes Request other than string, []byte and *FormData, and sets the
+	// Content-Type header if it's not set. The one set by WithEncoder, or JSON without
+	// Content-Type header is used by default.
+	Encoder Encoder `json:"-"`
+
+	ctx            context.Context // set by RequestBuilder.Context
+	callCtx        context.Context // the context of the ongoing DoContext call
+	defaultEncoder Encoder         // set by WithEncoder
+	throttle       Throttle
+	aborted        bool
+	abortedReason  string
 }
 
 // Abort abort current request.
@@ -38,7 +55,10 @@ type Response struct {
 	*http.Response
 	Request *RequestOptions
 	Body    []byte
-	err     error // deferred error for easy chaining
+	// Attempts is the number of attempts made, see WithRetryPolicy.
+	Attempts int
+	err      error       // deferred error for easy chaining
+	stream   *streamBody // unread body in streaming mode
 }
 
 // Error returns the error
@@ -93,6 +113,12 @@ type Client struct {
 
 	requestInterceptors  []RequestInterceptor
 	responseInterceptors []ResponseInterceptor
+	retryPolicy          *RetryPolicy
+	breakers             *breakerGroup
+	limiters             []*ruleLimiter
+	maxBodySize          int64
+	encoder              Encoder
+	accessLog            *AccessLogConfig
 }
 
 // NewClient creates a new client object.
@@ -108,47 +134,94 @@ func NewClient(options ...ClientOption) *Client {
 	return cc
 }
 
-// Do sends an HTTP request based on RequestOptions.
+// Do sends an HTTP request based on RequestOptions, with the context set by
+// RequestBuilder.Context or context.Background().
 func (c *Client) Do(opts *RequestOptions) (resp *Response) {
+	if opts == nil {
+		return &Response{err: fmt.Errorf("invalid request options")}
+	}
+
+	return c.DoContext(opts.Context(), opts)
+}
+
+// DoContext sends an HTTP request based on RequestOptions with context ctx. Canceling
+// ctx aborts both the in-flight request and the reading of response body. The metadata
+// within ctx, see logger.AppendMetadata, is logged along with the request.
+func (c *Client) DoContext(ctx context.Context, opts *RequestOptions) (resp *Response) {
+	if opts == nil {
+		return &Response{err: fmt.Errorf("invalid request options")}
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// the context is for this call only, later calls with the same options must not reuse it
+	opts.callCtx = ctx
+	opts.defaultEncoder = c.encoder
+	start := time.Now()
+
 	defer func() {
+		opts.callCtx = nil
+
 		if r := recover(); r != nil {
+			if resp == nil {
+				resp = &Response{Request: opts}
+			}
 			resp.err = fmt.Errorf("recover from panic: %v", r)
 		}
 
-		if c.Logger == nil {
-			return
-		}
+		c.logAccess(ctx, opts, resp, start)
+	}()
 
-		if resp.err != nil {
-			c.Logger.Error("handle request", zap.Any("options", opts), zap.Error(resp.err))
-			return
+	opts.throttle = Throttle{}
+	release, err := c.acquireLimits(opts)
+	if err != nil {
+		// the rejected request is never sent, so that only response interceptors are called
+		resp = &Response{Request: opts, err: err}
+		c.interceptResponse(resp)
+		return resp
+	}
+	defer func() {
+		if release != nil {
+			// the limits are not handed over to doWithRetry
+			release()
 		}
 
-		c.Logger.Info("handle request", zap.Any("options", opts))
+		if resp != nil && resp.err != nil {
+			resp.closeStream()
+		}
 	}()
 
 	for _, interceptor := range c.requestInterceptors {
 		interceptor(opts)
 		if opts.aborted {
 			return &Response{
-				err: fmt.Errorf("request aborted, reason: %s", opts.abortedReason),
+				Request: opts,
+				err:     fmt.Errorf("request aborted, reason: %s", opts.abortedReason),
 			}
 		}
 	}
 
-	resp = c.do(opts)
-	if resp.err != nil {
+	limits := release
+	release = nil
+	resp = c.doWithRetry(opts, limits)
+	if resp.err != nil && !errors.Is(resp.err, ErrThrottled) {
 		return
 	}
 
+	c.interceptResponse(resp)
+	return
+}
+
+// interceptResponse calls the response interceptors until one of them fails.
+func (c *Client) interceptResponse(resp *Response) {
 	for _, interceptor := range c.responseInterceptors {
 		if err := interceptor(resp); err != nil {
 			resp.err = err
-			return resp
+			return
 		}
 	}
-
-	return
 }
 
 func (c *Client) do(opts *RequestOptions) (resp *Response) {
@@ -170,28 +243,38 @@ func (c *Client) do(opts *RequestOptions) (resp *Response) {
 		return
 	}
 
-	req, err := opts.makeRequest()
+	ctx := opts.Context()
+	cancel := context.CancelFunc(func() {})
+	if opts.Timeout > 0 {
+		// the timeout covers reading the response body
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+
+	req, err := opts.makeRequest(ctx)
 	if err != nil {
+		cancel()
 		return
 	}
 
 	var res *http.Response
 	res, err = c.httpClient.Do(req)
 	if err != nil {
+		cancel()
 		return
 	}
 
-	defer res.Body.Close()
-
 	// make response
 	resp.Response = res
-	data, err := ioutil.ReadAll(res.Body)
-	if err != nil {
+	if opts.Stream {
+		// the timeout is released once the caller closes the body
+		resp.stream = &streamBody{ReadCloser: res.Body, closers: []func(){cancel}}
 		return
 	}
 
-	resp.Body = data
+	defer cancel()
+	defer res.Body.Close()
 
+	resp.Body, err = c.readBody(res)
 	return
 }
 
@@ -211,14 +294,30 @@ func (opts *RequestOptions) validate() error {
 	return nil
 }
 
-func (opts *RequestOptions) makeRequest() (*http.Request, error) {
-	buffer, err := opts.makeRequestBuffer(opts.Request)
+// Context returns the context of the request, which is the one passed to Client.DoContext
+// while the request is being sent, or the one set by RequestBuilder.Context, or
+// context.Background() by default.
+func (opts *RequestOptions) Context() context.Context {
+	if opts.callCtx != nil {
+		return opts.callCtx
+	}
+	if opts.ctx == nil {
+		return context.Background()
+	}
+	return opts.ctx
+}
+
+func (opts *RequestOptions) makeRequest(ctx context.Context) (*http.Request, error) {
+	buffer, err := opts.makeRequestBuffer(opts.Request, opts.encoder())
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
 
-	req, err := http.NewRequest(opts.Method, opts.URL, buffer)
+	req, err := http.NewRequestWithContext(ctx, opts.Method, opts.URL, buffer)
 	if err != nil {
+		if closer, ok := buffer.(io.Closer); ok {
+			closer.Close()
+		}
 		return nil, err
 	}
 	req.Header = opts.Header
@@ -226,9 +325,38 @@ func (opts *RequestOptions) makeRequest() (*http.Request, error) {
 	return req, nil
 }
 
+// encoder returns the encoder of request body, nil for the default JSON encoding.
+func (opts *RequestOptions) encoder() Encoder {
+	if opts.Encoder != nil {
+		return opts.Encoder
+	}
+	return opts.defaultEncoder
+}
+
+// bodyBytes encodes the request body into bytes, which replace the request body so that
+// the bytes sent are exactly the ones returned.
+func (opts *RequestOptions) bodyBytes() ([]byte, error) {
+	if opts.Header == nil {
+		opts.Header = http.Header{}
+	}
+
+	buffer, err := opts.makeRequestBuffer(opts.Request, opts.encoder())
+	if err != nil || buffer == nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadAll(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Request = data
+	return data, nil
+}
+
 // application/json , application/x-www-form-urlencoded , multipart/form-data
 
-func (opts *RequestOptions) makeRequestBuffer(body interface{}) (io.Reader, error) {
+func (opts *RequestOptions) makeRequestBuffer(body interface{}, encoder Encoder) (io.Reader, error) {
 	if body == nil {
 		return nil, nil
 	}
@@ -245,6 +373,18 @@ func (opts *RequestOptions) makeRequestBuffer(body interface{}) (io.Reader, erro
 		return opts.makeFormDataBuffer()
 	}
 
+	if encoder != nil {
+		data, err := encoder.Encode(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request body with %T: %s", encoder, err)
+		}
+
+		if opts.Header.Get("Content-Type") == "" {
+			opts.Header.Set("Content-Type", encoder.ContentType())
+		}
+		return bytes.NewBuffer(data), nil
+	}
+
 	// assume that body is json serializable
 	data, err := json.Marshal(body)
 	if err != nil {
@@ -264,31 +404,32 @@ func (opts *RequestOptions) makeFormDataBuffer() (io.Reader, error) {
 		return nil, nil
 	}
 
-	if fd.file == nil {
+	if len(fd.files) == 0 {
 		opts.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		return strings.NewReader(fd.Values.Encode()), nil
 	}
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	for k, vs := range fd.Values {
-		for index := range vs {
-			writer.WriteField(k, vs[index])
-		}
-	}
-
-	fw, err := writer.CreateFormFile(fd.file.fieldname, fd.file.filename)
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = io.Copy(fw, bytes.NewBuffer(fd.file.data))
-	if err != nil {
-		return nil, err
-	}
-
-	writer.Close()
+	// the multipart body is streamed through a pipe, the writing goroutine exits once
+	// the body is read to the end or closed by http client.
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(fd.writeMultipart(writer))
+	}()
 
 	opts.Header.Set("Content-Type", writer.FormDataContentType())
-	return body, nil
+	return pr, nil
+}
+
+// metadataFields converts the metadata within ctx into log fields.
+func metadataFields(ctx context.Context) []zap.Field {
+	var fields []zap.Field
+	logger.MetadataFromContext(ctx).Range(func(key string, value []string) {
+		if len(value) == 1 {
+			fields = append(fields, zap.String(key, value[0]))
+		} else {
+			fields = append(fields, zap.Strings(key, value))
+		}
+	})
+	return fields
 }
@@ -1 +1,1204 @@
 package convhttp
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jiandahao/goutils/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func newUserServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/users":
+			if r.URL.Query().Get("id") != "1" {
+				w.Header().Set("X-Error", "not found")
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(strings.Repeat("user not found. ", 100)))
+				return
+			}
+			json.NewEncoder(w).Encode(&user{ID: 1, Name: "alice"})
+		case r.Method == http.MethodPost && r.URL.Path == "/users":
+			if r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+			}
+			var u user
+			if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			u.ID = 2
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(&u)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func TestClient_Helpers(t *testing.T) {
+	server := newUserServer(t)
+	defer server.Close()
+
+	ctx := context.Background()
+	client := NewClient()
+
+	var u user
+	if err := client.Get(ctx, server.URL+"/users", url.Values{"id": {"1"}}, &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 1 || u.Name != "alice" {
+		t.Fatalf("unexpected user %+v", u)
+	}
+
+	var created user
+	if err := client.PostJSON(ctx, server.URL+"/users", &user{Name: "bob"}, &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != 2 || created.Name != "bob" {
+		t.Fatalf("unexpected user %+v", created)
+	}
+
+	if err := client.Delete(ctx, server.URL+"/users/2", &u); err != nil {
+		t.Fatal(err)
+	}
+
+	err := client.PutJSON(ctx, server.URL+"/users/2", &u, nil)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusMethodNotAllowed || httpErr.Method != http.MethodPut {
+		t.Fatalf("wanted HTTPError with status 405 but got %v", err)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	server := newUserServer(t)
+	defer server.Close()
+
+	var u user
+	err := NewClient().NewRequest(http.MethodGet, server.URL+"/users").
+		Query("id", "3").
+		Into(&u)
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("wanted HTTPError but got %v", err)
+	}
+
+	if httpErr.StatusCode != http.StatusNotFound || httpErr.Header.Get("X-Error") != "not found" {
+		t.Fatalf("unexpected error %+v", httpErr)
+	}
+
+	if len(httpErr.Body) != maxErrorBodySize || !strings.HasPrefix(string(httpErr.Body), "user not found.") {
+		t.Fatalf("unexpected body excerpt %q", httpErr.Body)
+	}
+
+	if !strings.Contains(httpErr.URL, "/users") || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("unexpected error message %q", err.Error())
+	}
+}
+
+// newSlowServer returns a server that sends the header at once, but blocks the body until closed.
+func newSlowServer() (*httptest.Server, chan struct{}) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	return server, done
+}
+
+func TestClient_Timeout(t *testing.T) {
+	server, done := newSlowServer()
+	defer server.Close()
+	defer close(done)
+
+	start := time.Now()
+	resp := NewClient().NewRequest(http.MethodGet, server.URL).Timeout(100 * time.Millisecond).Do()
+	if !errors.Is(resp.Error(), context.DeadlineExceeded) {
+		t.Fatalf("wanted deadline exceeded but got %v", resp.Error())
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("reading body should be aborted, but took %v", elapsed)
+	}
+}
+
+func TestClient_DoContext(t *testing.T) {
+	server, done := newSlowServer()
+	defer server.Close()
+	defer close(done)
+
+	core, logs := observer.New(zap.InfoLevel)
+	client := NewClient(WithLogger(zap.New(core)))
+
+	ctx, cancel := context.WithCancel(logger.AppendMetadata(context.Background(),
+		logger.NewMetadata().Append("trace_id", "abc")))
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	resp := client.DoContext(ctx, &RequestOptions{URL: server.URL})
+	if !errors.Is(resp.Error(), context.Canceled) {
+		t.Fatalf("wanted canceled but got %v", resp.Error())
+	}
+
+	entries := logs.All()
+	if len(entries) != 1 || entries[0].ContextMap()["trace_id"] != "abc" {
+		t.Fatalf("metadata should be logged, but got %+v", entries)
+	}
+
+	// the context is not kept in the options for later calls
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+
+	opts := &RequestOptions{URL: fast.URL}
+	if resp := client.DoContext(ctx, opts); !errors.Is(resp.Error(), context.Canceled) {
+		t.Fatalf("wanted canceled but got %v", resp.Error())
+	}
+	if resp := client.Do(opts); resp.Error() != nil {
+		t.Fatalf("later call should not use the canceled context, but got %v", resp.Error())
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	var attempts int
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		data, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+
+		switch {
+		case r.URL.Path == "/reset" && attempts == 1:
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		case attempts < 3:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"id":1}`))
+		}
+	}))
+	defer server.Close()
+
+	// the transport retries the idempotent requests on reused connections by itself
+	client := NewClient(
+		WithHTTPClient(&http.Client{Transport: &http.Transport{DisableKeepAlives: true}}),
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond}),
+	)
+
+	cases := []struct {
+		name     string
+		opts     *RequestOptions
+		attempts int
+		status   int
+	}{
+		{"get", &RequestOptions{URL: server.URL}, 3, http.StatusOK},
+		{"post", &RequestOptions{Method: http.MethodPost, URL: server.URL, Request: "data"}, 1, http.StatusBadGateway},
+		{
+			"post with idempotency key",
+			&RequestOptions{Method: http.MethodPost, URL: server.URL, Request: "data", Header: http.Header{"Idempotency-Key": {"1"}}},
+			3,
+			http.StatusOK,
+		},
+		{"connection reset", &RequestOptions{URL: server.URL + "/reset"}, 3, http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		attempts, bodies = 0, nil
+		resp := client.Do(tc.opts)
+		if resp.Attempts != tc.attempts || attempts != tc.attempts {
+			t.Fatalf("%s: wanted %d attempts, but got %d and server received %d", tc.name, tc.attempts, resp.Attempts, attempts)
+		}
+
+		if resp.Error() != nil || resp.StatusCode != tc.status {
+			t.Fatalf("%s: unexpected response %v, %v", tc.name, resp.Error(), resp.Status)
+		}
+
+		// the body is rebuilt for every attempt
+		for _, body := range bodies {
+			if tc.opts.Request != nil && body != tc.opts.Request {
+				t.Fatalf("%s: unexpected body %q", tc.name, body)
+			}
+		}
+	}
+
+	// permanent errors of http client are not retried
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+
+	redirectClient := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return errors.New("redirect not allowed")
+	}}
+	redirectServer := httptest.NewServer(http.RedirectHandler("/target", http.StatusFound))
+	defer redirectServer.Close()
+
+	for name, c := range map[string]*Client{
+		"tls":      client,
+		"redirect": NewClient(WithHTTPClient(redirectClient), WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond})),
+	} {
+		target := tlsServer.URL
+		if name == "redirect" {
+			target = redirectServer.URL
+		}
+		resp := c.Do(&RequestOptions{URL: target})
+		if resp.Error() == nil || resp.Attempts != 1 {
+			t.Fatalf("%s: wanted 1 attempt with error, but got %d, %v", name, resp.Attempts, resp.Error())
+		}
+	}
+
+	for _, err := range []error{
+		&url.Error{Op: "Get", URL: "ftp://example.com", Err: errors.New(`unsupported protocol scheme "ftp"`)},
+		&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("x509: certificate signed by unknown authority")},
+	} {
+		if isTransientError(err) {
+			t.Fatalf("%v should not be transient", err)
+		}
+	}
+	if !isTransientError(&url.Error{Op: "Get", URL: "https://example.com", Err: io.ErrUnexpectedEOF}) {
+		t.Fatal("unexpected EOF should be transient")
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: -1}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, d := range want {
+		if got := policy.backoff(i+1, nil); got != d {
+			t.Fatalf("backoff of retry %d: wanted %v, got %v", i+1, d, got)
+		}
+	}
+
+	// Retry-After takes precedence over the backoff, and is limited by MaxBackoff
+	for value, d := range map[string]time.Duration{"0": 0, "120": time.Second} {
+		resp := &Response{Response: &http.Response{Header: http.Header{"Retry-After": {value}}}}
+		if got := policy.backoff(1, resp); got != d {
+			t.Fatalf("backoff with Retry-After %s: wanted %v, got %v", value, d, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := policy.backoff(1, nil); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("backoff %v is out of jitter range", d)
+		}
+	}
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	var hits int
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	var transitions []string
+	client := NewClient(WithCircuitBreaker(CircuitBreakerConfig{
+		ConsecutiveFailures: 3,
+		FailureRatio:        -1,
+		OpenTimeout:         100 * time.Millisecond,
+		OnStateChange: func(host string, from BreakerState, to BreakerState) {
+			transitions = append(transitions, from.String()+"->"+to.String())
+		},
+	}))
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	for i := 0; i < 3; i++ {
+		if resp := client.Do(&RequestOptions{URL: server.URL}); resp.Error() != nil {
+			t.Fatal(resp.Error())
+		}
+	}
+
+	if state := client.BreakerState(host); state != BreakerOpen {
+		t.Fatalf("breaker should be open, but got %v", state)
+	}
+
+	// fails fast without hitting the server
+	resp := client.Do(&RequestOptions{URL: server.URL})
+	if !errors.Is(resp.Error(), ErrCircuitOpen) || hits != 3 {
+		t.Fatalf("wanted ErrCircuitOpen without hitting server, but got %v with %d hits", resp.Error(), hits)
+	}
+
+	// a failed probe opens the breaker again
+	time.Sleep(150 * time.Millisecond)
+	client.Do(&RequestOptions{URL: server.URL})
+	if state := client.BreakerState(host); state != BreakerOpen || hits != 4 {
+		t.Fatalf("breaker should be open again, but got %v with %d hits", state, hits)
+	}
+
+	// a canceled probe neither closes the breaker nor holds the probe slot
+	status = http.StatusOK
+	time.Sleep(150 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if resp := client.DoContext(ctx, &RequestOptions{URL: server.URL}); !errors.Is(resp.Error(), context.Canceled) {
+		t.Fatalf("wanted canceled but got %v", resp.Error())
+	}
+	if state := client.BreakerState(host); state != BreakerHalfOpen {
+		t.Fatalf("breaker should be half-open, but got %v", state)
+	}
+
+	// a successful probe closes the breaker
+	if resp := client.Do(&RequestOptions{URL: server.URL}); resp.Error() != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response %v", resp.Error())
+	}
+
+	want := []string{"closed->open", "open->half_open", "half_open->open", "open->half_open", "half_open->closed"}
+	if strings.Join(transitions, ",") != strings.Join(want, ",") {
+		t.Fatalf("wanted transitions %v, but got %v", want, transitions)
+	}
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var throttles []Throttle
+	interceptor := func(opts *RequestOptions) {
+		throttles = append(throttles, opts.Throttle())
+	}
+
+	client := NewClient(
+		WithLimits(
+			LimitRule{Path: "/v1/*", Rate: 10, Burst: 1},
+			LimitRule{Name: "fail-fast", Path: "/v2", Rate: 1, Burst: 1, FailFast: true},
+		),
+		WithRequestInterceptors(interceptor),
+	)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if resp := client.Do(&RequestOptions{URL: server.URL + "/v1/users"}); resp.Error() != nil {
+			t.Fatal(resp.Error())
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("requests should be delayed by rate limit, but took %v", elapsed)
+	}
+
+	if throttles[0].Waited != 0 || throttles[2].Waited == 0 || throttles[2].Rules[0] != "/v1/*" {
+		t.Fatalf("unexpected throttles %+v", throttles)
+	}
+
+	// not limited by the rules
+	start = time.Now()
+	for i := 0; i < 10; i++ {
+		client.Do(&RequestOptions{URL: server.URL + "/v3"})
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("requests should not be limited, but took %v", elapsed)
+	}
+
+	throttles = nil
+	var rejected []Throttle
+	client = NewClient(
+		WithLimits(LimitRule{Name: "fail-fast", Path: "/v2", Rate: 1, Burst: 1, FailFast: true}),
+		WithRequestInterceptors(interceptor),
+		WithResponseInterceptors(func(resp *Response) error {
+			if resp.Throttle().Rejected {
+				rejected = append(rejected, resp.Throttle())
+			}
+			return nil
+		}),
+	)
+	client.Do(&RequestOptions{URL: server.URL + "/v2"})
+	resp := client.Do(&RequestOptions{URL: server.URL + "/v2"})
+	if !errors.Is(resp.Error(), ErrThrottled) {
+		t.Fatalf("wanted ErrThrottled but got %v", resp.Error())
+	}
+
+	if len(throttles) != 1 {
+		t.Fatalf("request interceptors should not be called for rejected requests, but got %+v", throttles)
+	}
+
+	if len(rejected) != 1 || rejected[0].Rules[0] != "fail-fast" {
+		t.Fatalf("rejection should be visible to response interceptors, but got %+v", rejected)
+	}
+}
+
+func TestClient_RateLimitRetry(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(
+		WithLimits(LimitRule{Rate: 1, Burst: 1, FailFast: true}),
+		WithRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+	)
+
+	resp := client.Do(&RequestOptions{URL: server.URL})
+	if !errors.Is(resp.Error(), ErrThrottled) || resp.Attempts != 1 {
+		t.Fatalf("retry should be throttled, but got %v after %d attempts", resp.Error(), resp.Attempts)
+	}
+
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatalf("retries should acquire the limits again, but the server got %d requests", n)
+	}
+}
+
+func TestClient_Abort(t *testing.T) {
+	client := NewClient(WithRequestInterceptors(func(opts *RequestOptions) {
+		opts.Abort("no token")
+	}))
+
+	opts := &RequestOptions{URL: "http://127.0.0.1:0"}
+	resp := client.Do(opts)
+	if resp.Error() == nil || !strings.Contains(resp.Error().Error(), "no token") {
+		t.Fatalf("request should be aborted, but got %v", resp.Error())
+	}
+
+	if resp.Request != opts {
+		t.Fatalf("aborted response should refer to the request")
+	}
+}
+
+func TestClient_MaxInFlight(t *testing.T) {
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	client := NewClient(WithLimits(LimitRule{PerHost: true, MaxInFlight: 2}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp := client.Do(&RequestOptions{URL: server.URL}); resp.Error() != nil {
+				t.Error(resp.Error())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 2 {
+		t.Fatalf("wanted at most 2 in-flight requests, but got %d", maxInFlight)
+	}
+
+	// waiting for the limits honours the context
+	release, err := client.acquireLimits(&RequestOptions{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	client.acquireLimits(&RequestOptions{URL: server.URL})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp := client.DoContext(ctx, &RequestOptions{URL: server.URL})
+	if !errors.Is(resp.Error(), context.DeadlineExceeded) {
+		t.Fatalf("wanted deadline exceeded but got %v", resp.Error())
+	}
+}
+
+func TestFormData_Files(t *testing.T) {
+	type part struct {
+		field, filename, contentType string
+		size                         int
+	}
+
+	var received []part
+	var fields url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != -1 {
+			t.Errorf("multipart body should be streamed, but got content length %d", r.ContentLength)
+		}
+
+		mr, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		received, fields = nil, url.Values{}
+		for {
+			p, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+
+			data, _ := ioutil.ReadAll(p)
+			if p.FileName() == "" {
+				fields.Add(p.FormName(), string(data))
+				continue
+			}
+			received = append(received, part{p.FormName(), p.FileName(), p.Header.Get("Content-Type"), len(data)})
+		}
+	}))
+	defer server.Close()
+
+	// 16MB file generated on the fly
+	large := io.LimitReader(zeroReader{}, 16<<20)
+
+	fd := NewFormData()
+	fd.Add("name", "files")
+	fd.WithFile("file", "a.txt", []byte("hello"))
+	if err := fd.AddFile("file", "b.bin", "application/x-test", large); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := NewClient().Do(&RequestOptions{Method: http.MethodPost, URL: server.URL, Request: fd})
+	if resp.Error() != nil {
+		t.Fatal(resp.Error())
+	}
+
+	want := []part{
+		{"file", "a.txt", "application/octet-stream", 5},
+		{"file", "b.bin", "application/x-test", 16 << 20},
+	}
+	if len(received) != 2 || received[0] != want[0] || received[1] != want[1] || fields.Get("name") != "files" {
+		t.Fatalf("wanted %+v, but got %+v, %v", want, received, fields)
+	}
+
+	// a reader that's not seekable could not be sent again
+	resp = NewClient().Do(&RequestOptions{Method: http.MethodPost, URL: server.URL, Request: fd})
+	if resp.Error() == nil {
+		t.Fatalf("sending a consumed reader should fail")
+	}
+
+	// a seekable reader is re-read from its offset
+	fd = NewFormData()
+	fd.AddFile("file", "c.txt", "text/plain", strings.NewReader("seekable"))
+	for i := 0; i < 2; i++ {
+		resp = NewClient().Do(&RequestOptions{Method: http.MethodPost, URL: server.URL, Request: fd})
+		if resp.Error() != nil || len(received) != 1 || received[0].size != len("seekable") {
+			t.Fatalf("unexpected result %v, %+v", resp.Error(), received)
+		}
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestResponse_Stream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ndjson":
+			w.Write([]byte("{\"id\":1,\"name\":\"alice\"}\n{\"id\":2,\"name\":\"bob\"}\n"))
+		case "/sse":
+			w.Write([]byte(": comment\n\nid: 1\nevent: greeting\ndata: hello\ndata:  world\n\n" +
+				"data: no id\r\nretry: 1000\r\n\r\nevent: empty\n\ndata: incomplete"))
+		default:
+			w.Write([]byte(strings.Repeat("x", 1024)))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(WithMaxBodySize(512))
+
+	resp := client.Do(&RequestOptions{URL: server.URL})
+	if !errors.Is(resp.Error(), ErrBodyTooLarge) {
+		t.Fatalf("wanted ErrBodyTooLarge but got %v", resp.Error())
+	}
+
+	// max body size doesn't apply to streaming mode
+	resp = client.Do(&RequestOptions{URL: server.URL, Stream: true})
+	body, err := resp.Stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(body)
+	body.Close()
+	if err != nil || len(data) != 1024 || resp.Body != nil {
+		t.Fatalf("unexpected streaming body %d bytes, %v", len(data), err)
+	}
+
+	dec := client.Do(&RequestOptions{URL: server.URL + "/ndjson", Stream: true}).NDJSON()
+	defer dec.Close()
+
+	var users []user
+	for {
+		var u user
+		if err := dec.Next(&u); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+	if len(users) != 2 || users[1].Name != "bob" {
+		t.Fatalf("unexpected users %+v", users)
+	}
+
+	events := client.Do(&RequestOptions{URL: server.URL + "/sse", Stream: true}).Events()
+	defer events.Close()
+
+	want := []Event{
+		{ID: "1", Event: "greeting", Data: "hello\n world"},
+		{ID: "1", Data: "no id", Retry: time.Second},
+	}
+	for _, w := range want {
+		event, err := events.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *event != w {
+			t.Fatalf("wanted event %+v, but got %+v", w, event)
+		}
+	}
+
+	if _, err := events.Next(); err != io.EOF {
+		t.Fatalf("wanted io.EOF but got %v", err)
+	}
+}
+
+func TestDownloadToFile(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	filePath := t.TempDir() + "/file.txt"
+
+	// resumes from the partially downloaded file
+	if err := ioutil.WriteFile(filePath, []byte(content[:3000]), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var ranges []string
+	client := NewClient(WithRequestInterceptors(func(opts *RequestOptions) {
+		ranges = append(ranges, opts.Header.Get("Range"))
+	}))
+
+	for i := 0; i < 2; i++ {
+		n, err := client.DownloadToFile(context.Background(), &RequestOptions{URL: server.URL}, filePath)
+		if err != nil || n != int64(len(content)) {
+			t.Fatalf("unexpected result %d, %v", n, err)
+		}
+
+		data, _ := ioutil.ReadFile(filePath)
+		if string(data) != content {
+			t.Fatalf("downloaded file mismatched, got %d bytes", len(data))
+		}
+	}
+
+	if ranges[0] != "bytes=3000-" || ranges[1] != "bytes=10000-" {
+		t.Fatalf("unexpected ranges %v", ranges)
+	}
+
+	// the downloaded part is kept on failure
+	_, err := client.DownloadToFile(context.Background(), &RequestOptions{URL: server.URL + "/missing"}, filePath)
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("wanted HTTPError with status 404 but got %v", err)
+	}
+
+	if info, err := os.Stat(filePath); err != nil || info.Size() != int64(len(content)) {
+		t.Fatalf("downloaded file should be kept, %v", err)
+	}
+}
+
+type bindItem struct {
+	ID    int      `json:"id" xml:"id" yaml:"id" codec:"id" form:"id"`
+	Name  string   `json:"name" xml:"name" yaml:"name" codec:"name" form:"name"`
+	Tags  []string `json:"tags" xml:"tag" yaml:"tags" codec:"tags" form:"tag"`
+	Score float64  `json:"score" xml:"score" yaml:"score" codec:"score" form:"score,omitempty"`
+	Admin *bool    `json:"admin" xml:"admin" yaml:"admin" codec:"admin" form:"admin"`
+}
+
+type formInner struct {
+	ID int `form:"id"`
+}
+
+type FormPage struct {
+	Page int `form:"page"`
+}
+
+func TestFormBinder_Embedded(t *testing.T) {
+	var out struct {
+		*formInner
+		*FormPage
+		Name string `form:"name"`
+	}
+
+	if err := (&FormBinder{}).Bind([]byte("id=1&page=2&name=alice"), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// the unexported nil pointer is skipped as encoding/json does
+	if out.formInner != nil || out.FormPage == nil || out.Page != 2 || out.Name != "alice" {
+		t.Fatalf("unexpected result %+v", out)
+	}
+}
+
+func TestBinders(t *testing.T) {
+	admin := true
+	in := bindItem{ID: 1, Name: "alice", Tags: []string{"a", "b"}, Score: 1.5, Admin: &admin}
+
+	for _, enc := range []Encoder{&JSONBinder{}, &XMLBinder{}, &FormBinder{}, &YAMLBinder{}, &MsgpackBinder{}} {
+		data, err := enc.Encode(&in)
+		if err != nil {
+			t.Fatalf("%T: failed to encode: %v", enc, err)
+		}
+
+		binder, ok := BinderForContentType(enc.ContentType() + "; charset=utf-8")
+		if !ok || binder.Name() != enc.(Binder).Name() {
+			t.Fatalf("%T: unexpected binder for %s: %v", enc, enc.ContentType(), binder)
+		}
+
+		var out bindItem
+		if err := binder.Bind(data, &out); err != nil {
+			t.Fatalf("%s: failed to bind %q: %v", binder.Name(), data, err)
+		}
+		if out.ID != in.ID || out.Name != in.Name || strings.Join(out.Tags, ",") != "a,b" ||
+			out.Score != in.Score || out.Admin == nil || !*out.Admin {
+			t.Fatalf("%s: unexpected result %+v", binder.Name(), out)
+		}
+	}
+
+	data, err := (&ProtobufBinder{}).Encode(wrapperspb.String("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg wrapperspb.StringValue
+	if err := (&ProtobufBinder{}).Bind(data, &msg); err != nil || msg.GetValue() != "alice" {
+		t.Fatalf("unexpected protobuf result %v, %v", msg.GetValue(), err)
+	}
+	if err := (&ProtobufBinder{}).Bind(data, &in); err == nil {
+		t.Fatal("expected error for non proto.Message")
+	}
+
+	for contentType, name := range map[string]string{
+		"application/problem+json": "json_binder",
+		"text/xml":                 "xml_binder",
+		"application/atom+xml":     "xml_binder",
+		"text/yaml":                "yaml_binder",
+		"application/x-msgpack":    "msgpack_binder",
+		"application/protobuf":     "protobuf_binder",
+	} {
+		if binder, ok := BinderForContentType(contentType); !ok || binder.Name() != name {
+			t.Fatalf("unexpected binder for %s: %v", contentType, binder)
+		}
+	}
+	if _, ok := BinderForContentType("text/plain"); ok {
+		t.Fatal("unexpected binder for text/plain")
+	}
+}
+
+func TestResponse_ShouldBind(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// echo the request body with its content type
+		body, _ := ioutil.ReadAll(r.Body)
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		if r.URL.Path == "/proto" {
+			data, _ := proto.Marshal(wrapperspb.String(string(body)))
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			w.Write(data)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	in := &bindItem{ID: 1, Name: "alice", Tags: []string{"a"}}
+
+	client := NewClient(WithEncoder(&XMLBinder{}))
+	resp := client.Do(&RequestOptions{Method: http.MethodPost, URL: server.URL, Request: in})
+	if got := resp.Header.Get("Content-Type"); got != "application/xml" {
+		t.Fatalf("unexpected content type %q", got)
+	}
+	var out bindItem
+	if err := resp.ShouldBind(&out); err != nil || out.Name != "alice" {
+		t.Fatalf("unexpected result %+v, %v", out, err)
+	}
+
+	out = bindItem{}
+	err := client.NewRequest(http.MethodPost, server.URL).Encoder(&MsgpackBinder{}).Body(in).Do().ShouldBind(&out)
+	if err != nil || out.Name != "alice" {
+		t.Fatalf("unexpected result %+v, %v", out, err)
+	}
+
+	// JSON overrides the encoder of client
+	out = bindItem{}
+	resp = client.NewRequest(http.MethodPost, server.URL).JSON(in).Do()
+	if err := resp.ShouldBind(&out); err != nil || out.Name != "alice" || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected result %+v, %v", out, err)
+	}
+
+	var msg wrapperspb.StringValue
+	if err := NewClient().NewRequest(http.MethodPost, server.URL+"/proto").Body("alice").Do().ShouldBind(&msg); err != nil || msg.GetValue() != "alice" {
+		t.Fatalf("unexpected result %v, %v", msg.GetValue(), err)
+	}
+
+	resp = NewClient().NewRequest(http.MethodPost, server.URL).Header("Content-Type", "text/plain").Body("alice").Do()
+	if err := resp.ShouldBind(&out); err == nil {
+		t.Fatal("expected error for text/plain")
+	}
+}
+
+func TestAuthInterceptors(t *testing.T) {
+	config := HMACConfig{KeyID: "k1", Secret: []byte("secret"), Now: func() time.Time { return time.Unix(1600000000, 0) }}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bearer":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		case "/basic":
+			if username, password, ok := r.BasicAuth(); !ok || username != "alice" || password != "p:ss" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			signature := config.Sign(r.Method, r.URL.EscapedPath(), r.URL.Query(), body, r.Header.Get("X-Timestamp"))
+			if r.Header.Get("X-Key-Id") != "k1" || r.Header.Get("X-Timestamp") != "1600000000" ||
+				!hmac.Equal([]byte(signature), []byte(r.Header.Get("X-Signature"))) {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	if err := NewClient(WithRequestInterceptors(BearerToken("token"))).Get(ctx, server.URL+"/bearer", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewClient(WithRequestInterceptors(BasicAuth("alice", "p:ss"))).Get(ctx, server.URL+"/basic", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(WithRequestInterceptors(HMACSigner(config)), WithEncoder(&XMLBinder{}))
+	if err := client.NewRequest(http.MethodPost, server.URL+"/hmac/a%2Fb").Query("b", "2").Query("a", "1").Query("a", "0").Body(&user{ID: 1}).Into(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	fd := NewFormData()
+	fd.Set("name", "alice")
+	fd.WithFile("file", "a.txt", []byte("hello"))
+	if err := client.NewRequest(http.MethodPut, server.URL+"/hmac").Body(fd).Into(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the signature covers the body
+	tampering := func(opts *RequestOptions) { opts.Request = []byte("tampered") }
+	client = NewClient(WithRequestInterceptors(HMACSigner(config), tampering))
+	var httpErr *HTTPError
+	if err := client.NewRequest(http.MethodPost, server.URL+"/hmac").Body("body").Into(nil); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %v", err)
+	}
+
+	if got := canonicalQuery(url.Values{"b": {"2"}, "a": {"1", "0"}, "c d": {"&"}}); got != "a=0&a=1&b=2&c+d=%26" {
+		t.Fatalf("unexpected canonical query %s", got)
+	}
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	var tokens int32
+	var expiresIn int32 = 3600
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+		if r.Method != http.MethodPost || username != "client%3A1" || password != "secret" ||
+			r.PostFormValue("grant_type") != "client_credentials" || r.PostFormValue("scope") != "read write" ||
+			r.PostFormValue("audience") != "api" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_client","error_description":"bad credentials"}`))
+			return
+		}
+
+		n := atomic.AddInt32(&tokens, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":"%d"}`, n, atomic.LoadInt32(&expiresIn))
+	}))
+	defer tokenServer.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	config := OAuth2Config{
+		TokenURL:       tokenServer.URL,
+		ClientID:       "client:1",
+		ClientSecret:   "secret",
+		Scopes:         []string{"read", "write"},
+		EndpointParams: url.Values{"audience": {"api"}},
+		RefreshBefore:  10 * time.Second,
+	}
+	source := NewOAuth2TokenSource(config)
+	client := NewClient(WithRequestInterceptors(source.Interceptor()))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := client.NewRequest(http.MethodGet, server.URL).Do()
+			if resp.Error() != nil || string(resp.Body) != "Bearer token-1" {
+				t.Errorf("unexpected result %s, %v", resp.Body, resp.Error())
+			}
+		}()
+	}
+	wg.Wait()
+	if tokens != 1 {
+		t.Fatalf("expected 1 token request, got %d", tokens)
+	}
+
+	// the token expiring within RefreshBefore is refreshed
+	atomic.StoreInt32(&expiresIn, 5)
+	source.Invalidate()
+	for _, want := range []string{"Bearer token-2", "Bearer token-3"} {
+		resp := client.NewRequest(http.MethodGet, server.URL).Do()
+		if resp.Error() != nil || string(resp.Body) != want {
+			t.Fatalf("unexpected result %s, %v, expected %s", resp.Body, resp.Error(), want)
+		}
+	}
+
+	config.ClientSecret = "wrong"
+	resp := NewClient(WithRequestInterceptors(OAuth2ClientCredentials(config))).NewRequest(http.MethodGet, server.URL).Do()
+	if resp.Error() == nil || !strings.Contains(resp.Error().Error(), "invalid_client") {
+		t.Fatalf("expected invalid_client error, got %v", resp.Error())
+	}
+}
+
+func TestOAuth2TokenSource_Cancel(t *testing.T) {
+	release := make(chan struct{})
+	canceled := make(chan struct{}, 2)
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server notices the canceled request only after reading the body
+		r.ParseForm()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			canceled <- struct{}{}
+			return
+		}
+		w.Write([]byte(`{"access_token":"token","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	source := NewOAuth2TokenSource(OAuth2Config{TokenURL: tokenServer.URL})
+
+	// the callers give up with their own context while the token endpoint hangs
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		_, err := source.Token(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Second {
+			t.Fatalf("expected deadline exceeded in time, got %v after %v", err, time.Since(start))
+		}
+	}
+
+	// the token request is canceled once nobody waits for it
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the token request to be canceled")
+	}
+
+	// a caller giving up doesn't fail the others waiting for the same request
+	done := make(chan error, 1)
+	go func() {
+		token, err := source.Token(context.Background())
+		if err == nil && token.AccessToken != "token" {
+			err = fmt.Errorf("unexpected token %s", token.AccessToken)
+		}
+		done <- err
+	}()
+
+	waiting := func() bool {
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		return source.refresh != nil && source.refresh.waiters == 1
+	}
+	for !waiting() {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := source.Token(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if token, err := source.Token(context.Background()); err != nil || token.AccessToken != "token" {
+		t.Fatalf("expected cached token, got %v, %v", token, err)
+	}
+}
+
+type fieldLogger struct {
+	logger.Logger
+	fields map[string]interface{}
+	msgs   *[]string
+}
+
+func (l *fieldLogger) WithField(key string, value interface{}) logger.Logger {
+	fields := map[string]interface{}{key: value}
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	return &fieldLogger{fields: fields, msgs: l.msgs}
+}
+
+func (l *fieldLogger) Infof(ctx context.Context, format string, args ...interface{}) {
+	*l.msgs = append(*l.msgs, fmt.Sprintf("INFO %s %v %v", format, l.fields["status"], l.fields["url"]))
+}
+
+func (l *fieldLogger) Errorf(ctx context.Context, format string, args ...interface{}) {
+	*l.msgs = append(*l.msgs, fmt.Sprintf("ERROR %s %v", format, l.fields["error"]))
+}
+
+func TestClient_AccessLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token":"secret","items":[{"secret":"s1","id":1},{"secret":"s2","id":2}],"note":"` + strings.Repeat("é", 100) + `"}`))
+	}))
+	defer server.Close()
+
+	core, logs := observer.New(zap.InfoLevel)
+	client := NewClient(WithLogger(zap.New(core)), WithAccessLog(AccessLogConfig{
+		RedactQuery:     []string{"api_key"},
+		RedactJSONPaths: []string{"token", "items.secret", "user.password"},
+		LogHeaders:      true,
+		LogRequestBody:  true,
+		LogResponseBody: true,
+		MaxBodySize:     120,
+	}))
+
+	ctx := logger.AppendMetadata(context.Background(), logger.NewMetadata().Append("trace_id", "abc"))
+	resp := client.NewRequest(http.MethodPost, strings.Replace(server.URL, "http://", "http://user:pass@", 1)+"/users").
+		Context(ctx).
+		Query("api_key", "secret").
+		Query("page", "1").
+		Header("Authorization", "Bearer secret").
+		JSON(map[string]interface{}{"user": map[string]string{"name": "alice", "password": "secret"}}).
+		Do()
+	if resp.Error() != nil {
+		t.Fatal(resp.Error())
+	}
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 log entry, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	for _, secret := range []string{"Bearer secret", "session=secret", `"secret"}`, `"s1"`, "pass@", "api_key=secret", `"token":"secret"`} {
+		if strings.Contains(fmt.Sprint(fields), secret) {
+			t.Fatalf("%s should be redacted, got %v", secret, fields)
+		}
+	}
+	if fields["trace_id"] != "abc" || fields["method"] != http.MethodPost || fields["status"] != int64(http.StatusOK) ||
+		fields["attempts"] != int64(1) || fields["response_size"] != int64(len(resp.Body)) || fields["request_size"] == nil {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+	if url := fields["url"].(string); !strings.Contains(url, "api_key=REDACTED") || !strings.Contains(url, "page=1") {
+		t.Fatalf("unexpected url %s", url)
+	}
+	if body := fields["request_body"].(string); body != `{"user":{"name":"alice","password":"REDACTED"}}` {
+		t.Fatalf("unexpected request body %s", body)
+	}
+	body := fields["response_body"].(string)
+	if !strings.HasPrefix(body, `{"items":[{"id":1,"secret":"REDACTED"},{"id":2,"secret":"REDACTED"}]`) ||
+		!strings.HasSuffix(body, "bytes truncated)") || !utf8.ValidString(body) {
+		t.Fatalf("unexpected response body %s", body)
+	}
+
+	// form fields and URLs in errors
+	logs.TakeAll()
+	form := NewFormData()
+	form.Set("client_id", "id")
+	form.Set("client_secret", "secret")
+	errorClient := NewClient(WithLogger(zap.New(core)), WithAccessLog(AccessLogConfig{
+		RedactQuery:    []string{"client_secret", "api_key"},
+		LogRequestBody: true,
+	}), WithResponseInterceptors(func(resp *Response) error {
+		return resp.CheckStatus().Error()
+	}))
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	errorClient.NewRequest(http.MethodPost, strings.Replace(notFound.URL, "http://", "http://user:pass@", 1)+"/missing").
+		Query("api_key", "secret").
+		Body(form).
+		Do()
+	errorClient.NewRequest(http.MethodGet, "http://127.0.0.1:1/unreachable").Query("api_key", "secret").Do()
+
+	for _, entry := range logs.TakeAll() {
+		fields := entry.ContextMap()
+		if fields["error"] == nil {
+			t.Fatalf("error should be logged, got %v", fields)
+		}
+		for _, secret := range []string{"pass@", "api_key=secret", `"client_secret":["secret"]`} {
+			if strings.Contains(fmt.Sprint(fields), secret) {
+				t.Fatalf("%s should be redacted, got %v", secret, fields)
+			}
+		}
+	}
+
+	// log through logger.Logger
+	var msgs []string
+	client = NewClient(WithAccessLog(AccessLogConfig{Logger: &fieldLogger{msgs: &msgs}}))
+	client.NewRequest(http.MethodGet, server.URL).Query("page", "2").Do()
+	client.NewRequest(http.MethodGet, "ftp://example.com").Do()
+	if len(msgs) != 2 || msgs[0] != "INFO handle request 200 "+server.URL+"?page=2" ||
+		msgs[1] != "ERROR handle request http: invalid request url" {
+		t.Fatalf("unexpected logs %q", msgs)
+	}
+}
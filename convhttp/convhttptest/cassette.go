@@ -0,0 +1,106 @@
+// Package convhttptest provides HTTP transports for testing the code using convhttp
+// clients, a Recorder recording and replaying real HTTP interactions with cassette
+// files, and a programmable MockTransport. Both of them are used with
+// convhttp.WithHTTPClient.
+package convhttptest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// Cassette is a list of recorded HTTP interactions, saved as a JSON file.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  *RecordedRequest  `json:"request"`
+	Response *RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a recorded HTTP request.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// RecordedResponse is a recorded HTTP response.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body is a recorded body, it's saved as a string if it's valid UTF-8, or a base64
+// encoded string with "base64:" prefix otherwise.
+type Body []byte
+
+const base64Prefix = "base64:"
+
+// MarshalJSON implements json.Marshaler.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) && !bytes.HasPrefix(b, []byte(base64Prefix)) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(base64Prefix + base64.StdEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	if len(s) >= len(base64Prefix) && s[:len(base64Prefix)] == base64Prefix {
+		decoded, err := base64.StdEncoding.DecodeString(s[len(base64Prefix):])
+		if err != nil {
+			return err
+		}
+		*b = decoded
+		return nil
+	}
+
+	*b = []byte(s)
+	return nil
+}
+
+// LoadCassette loads the cassette from file path.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cassette := &Cassette{}
+	if err := json.Unmarshal(data, cassette); err != nil {
+		return nil, err
+	}
+
+	return cassette, nil
+}
+
+// Save saves the cassette to file path, the parent directories are created if needed.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,160 @@
+package convhttptest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jiandahao/goutils/convhttp"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestRecorder(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.Write(body)
+			return
+		}
+		if n == 1 {
+			w.Write([]byte(`{"id":1,"name":"alice"}`))
+			return
+		}
+		w.Write([]byte(`{"id":1,"name":"bob"}`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cassettes", "users.json")
+
+	// record
+	recorder, err := NewRecorder(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := convhttp.NewClient(convhttp.WithHTTPClient(recorder.Client()))
+
+	var out user
+	if err := client.Get(ctx, server.URL+"/users", url.Values{"id": {"1"}, "v": {"2"}}, &out); err != nil || out.Name != "alice" {
+		t.Fatalf("unexpected result %+v, %v", out, err)
+	}
+	if err := client.Get(ctx, server.URL+"/users", url.Values{"id": {"1"}, "v": {"2"}}, &out); err != nil || out.Name != "bob" {
+		t.Fatalf("unexpected result %+v, %v", out, err)
+	}
+	resp := client.NewRequest(http.MethodPost, server.URL+"/users").Header("Authorization", "Bearer secret").JSON(&user{ID: 2, Name: "carol"}).Do()
+	if resp.Error() != nil || string(resp.Body) != `{"id":2,"name":"carol"}` {
+		t.Fatalf("unexpected result %s, %v", resp.Body, resp.Error())
+	}
+	if err := recorder.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cassette.Interactions) != 3 || cassette.Interactions[2].Request.Header.Get("Authorization") != "" {
+		t.Fatalf("unexpected cassette %+v", cassette.Interactions)
+	}
+
+	// replay in order, the query order doesn't matter
+	server.Close()
+	recorder, err = NewRecorder(path, ModeReplay, WithMatcher(MatchOn(MatchMethod, MatchURL, MatchQuery, MatchBody)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = convhttp.NewClient(convhttp.WithHTTPClient(recorder.Client()))
+
+	if err := client.Get(ctx, server.URL+"/users", url.Values{"id": {"2"}, "v": {"2"}}, &out); !errors.Is(err, ErrInteractionNotFound) {
+		t.Fatalf("expected ErrInteractionNotFound, got %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "bob"} {
+		if err := client.Get(ctx, server.URL+"/users", url.Values{"v": {"2"}, "id": {"1"}}, &out); err != nil || out.Name != name {
+			t.Fatalf("unexpected result %+v, %v, expected %s", out, err, name)
+		}
+	}
+
+	// JSON bodies are compared semantically
+	resp = client.Do(&convhttp.RequestOptions{Method: http.MethodPost, URL: server.URL + "/users", Request: `{"name": "carol", "id": 2}`})
+	if resp.Error() != nil || string(resp.Body) != `{"id":2,"name":"carol"}` {
+		t.Fatalf("unexpected result %s, %v", resp.Body, resp.Error())
+	}
+
+	resp = client.Do(&convhttp.RequestOptions{Method: http.MethodPost, URL: server.URL + "/users", Request: `{"id":3}`})
+	if !errors.Is(resp.Error(), ErrInteractionNotFound) {
+		t.Fatalf("expected ErrInteractionNotFound, got %v", resp.Error())
+	}
+	if _, err := NewRecorder(filepath.Join(t.TempDir(), "missing.json"), ModeReplay); err == nil {
+		t.Fatal("expected error for missing cassette")
+	}
+	if hits != 3 {
+		t.Fatalf("unexpected hits %d", hits)
+	}
+}
+
+func TestMockTransport(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMockTransport()
+	mock.On(http.MethodGet, "https://example.com/users?id=1").RespondJSON(http.StatusOK, &user{ID: 1, Name: "alice"}).Times(2)
+	mock.On(http.MethodGet, "https://example.com/users").RespondJSON(http.StatusNotFound, map[string]string{"error": "not found"})
+	mock.On(http.MethodPost, "https://example.com/users").Header("X-Token", "t").RespondError(errors.New("connection reset"))
+
+	client := convhttp.NewClient(convhttp.WithHTTPClient(mock.Client()))
+
+	var out user
+	for i := 0; i < 2; i++ {
+		out = user{}
+		if err := client.Get(ctx, "https://example.com/users", url.Values{"id": {"1"}, "x": {"y"}}, &out); err != nil || out.Name != "alice" {
+			t.Fatalf("unexpected result %+v, %v", out, err)
+		}
+	}
+
+	// the first route is exhausted
+	var httpErr *convhttp.HTTPError
+	if err := client.Get(ctx, "https://example.com/users", url.Values{"id": {"1"}}, &out); !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %v", err)
+	}
+
+	resp := client.NewRequest(http.MethodPost, "https://example.com/users").Header("X-Token", "t").JSON(&out).Do()
+	if resp.Error() == nil {
+		t.Fatal("expected error")
+	}
+
+	resp = client.NewRequest(http.MethodDelete, "https://example.com/users").Do()
+	if !errors.Is(resp.Error(), ErrNoMockRoute) {
+		t.Fatalf("expected ErrNoMockRoute, got %v", resp.Error())
+	}
+	if len(mock.Unmatched()) != 1 {
+		t.Fatalf("unexpected unmatched requests %v", mock.Unmatched())
+	}
+
+	mock = NewMockTransport()
+	mock.On("", "https://example.com/ping").Times(1)
+	tb := &testing.T{}
+	mock.AssertExpectations(tb)
+	if !tb.Failed() {
+		t.Fatal("expected unmet expectations")
+	}
+
+	// a route with invalid url fails the expectations even if it's never called
+	mock = NewMockTransport()
+	mock.On(http.MethodGet, "://example.com/users")
+	tb = &testing.T{}
+	mock.AssertExpectations(tb)
+	if !tb.Failed() {
+		t.Fatal("expected invalid route url to fail")
+	}
+}
@@ -0,0 +1,251 @@
+package convhttptest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// ErrNoMockRoute is returned by MockTransport when no route matches the request.
+var ErrNoMockRoute = errors.New("convhttptest: no mock route matches the request")
+
+// MockTransport is a programmable http.RoundTripper, it serves the requests with the
+// first matched route that is not exhausted.
+//
+//	mock := convhttptest.NewMockTransport()
+//	mock.On(http.MethodGet, "https://example.com/users?id=1").RespondJSON(http.StatusOK, &user).Times(1)
+//	client := convhttp.NewClient(convhttp.WithHTTPClient(mock.Client()))
+//	...
+//	mock.AssertExpectations(t)
+type MockTransport struct {
+	mu        sync.Mutex
+	routes    []*MockRoute
+	unmatched []*http.Request
+}
+
+// NewMockTransport returns a MockTransport without routes.
+func NewMockTransport() *MockTransport {
+	return &MockTransport{}
+}
+
+// Client returns an http client using the mock transport.
+func (m *MockTransport) Client() *http.Client {
+	return &http.Client{Transport: m}
+}
+
+// On adds a route matching the requests with method and rawURL, the scheme, host and
+// path of URL must equal, and the query parameters in rawURL must present in the
+// request. Empty method matches all methods. The route responds 200 with empty body
+// by default. A route with invalid rawURL matches nothing, and fails AssertExpectations.
+func (m *MockTransport) On(method string, rawURL string) *MockRoute {
+	route := &MockRoute{method: method, status: http.StatusOK}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		route.urlErr = fmt.Errorf("invalid mock route url %q: %w", rawURL, err)
+	} else {
+		route.url = u
+	}
+
+	m.mu.Lock()
+	m.routes = append(m.routes, route)
+	m.mu.Unlock()
+
+	return route
+}
+
+// RoundTrip implements http.RoundTripper.
+func (m *MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.mu.Lock()
+	var route *MockRoute
+	for _, r := range m.routes {
+		if r.match(req) && (r.times == 0 || r.calls < r.times) {
+			route = r
+			break
+		}
+	}
+	if route == nil {
+		m.unmatched = append(m.unmatched, req)
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s %s", ErrNoMockRoute, req.Method, req.URL)
+	}
+	route.calls++
+	m.mu.Unlock()
+
+	return route.respond(req)
+}
+
+// Unmatched returns the requests that no route matches.
+func (m *MockTransport) Unmatched() []*http.Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*http.Request(nil), m.unmatched...)
+}
+
+// AssertExpectations fails the test if any route has an invalid URL, any route with
+// Times is not called exactly the number of times, or any request is unmatched.
+func (m *MockTransport) AssertExpectations(t testing.TB) {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, route := range m.routes {
+		if route.urlErr != nil {
+			t.Errorf("mock route %s: %v", route.method, route.urlErr)
+			continue
+		}
+
+		if route.times > 0 && route.calls != route.times {
+			t.Errorf("mock route %s %s: expected %d calls, got %d", route.method, route.url, route.times, route.calls)
+		}
+	}
+
+	for _, req := range m.unmatched {
+		t.Errorf("unmatched request %s %s", req.Method, req.URL)
+	}
+}
+
+// MockRoute is a route of MockTransport.
+type MockRoute struct {
+	method  string
+	url     *url.URL
+	urlErr  error // the error of parsing url, the route matches nothing if it's set
+	header  http.Header
+	matches []func(req *http.Request) bool
+	times   int
+	calls   int // guarded by the mutex of MockTransport
+
+	status    int
+	resBody   []byte
+	resHeader http.Header
+	err       error
+	handler   func(req *http.Request) (*http.Response, error)
+}
+
+// Header requires the request header key to be value.
+func (r *MockRoute) Header(key string, value string) *MockRoute {
+	if r.header == nil {
+		r.header = http.Header{}
+	}
+	r.header.Add(key, value)
+	return r
+}
+
+// MatchFunc adds a custom matching function of the requests.
+func (r *MockRoute) MatchFunc(fn func(req *http.Request) bool) *MockRoute {
+	r.matches = append(r.matches, fn)
+	return r
+}
+
+// Times limits the route to serve n requests, 0 means unlimited.
+func (r *MockRoute) Times(n int) *MockRoute {
+	r.times = n
+	return r
+}
+
+// Respond responds with status, header and body.
+func (r *MockRoute) Respond(status int, header http.Header, body []byte) *MockRoute {
+	r.status, r.resHeader, r.resBody = status, header, body
+	return r
+}
+
+// RespondJSON responds with status and v encoded as JSON.
+func (r *MockRoute) RespondJSON(status int, v interface{}) *MockRoute {
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.err = fmt.Errorf("failed to marshal mock response: %w", err)
+		return r
+	}
+
+	return r.Respond(status, http.Header{"Content-Type": {"application/json"}}, data)
+}
+
+// RespondError fails the requests with err, such as a network error.
+func (r *MockRoute) RespondError(err error) *MockRoute {
+	r.err = err
+	return r
+}
+
+// RespondFunc responds with fn.
+func (r *MockRoute) RespondFunc(fn func(req *http.Request) (*http.Response, error)) *MockRoute {
+	r.handler = fn
+	return r
+}
+
+func (r *MockRoute) match(req *http.Request) bool {
+	if r.url == nil {
+		// the invalid route matches nothing
+		return false
+	}
+
+	if r.method != "" && r.method != req.Method {
+		return false
+	}
+
+	if r.url.Scheme != req.URL.Scheme || r.url.Host != req.URL.Host || r.url.Path != req.URL.Path {
+		return false
+	}
+
+	query := req.URL.Query()
+	for key, values := range r.url.Query() {
+		if !containsAll(query[key], values) {
+			return false
+		}
+	}
+
+	for key, values := range r.header {
+		if !containsAll(req.Header.Values(key), values) {
+			return false
+		}
+	}
+
+	for _, fn := range r.matches {
+		if !fn(req) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *MockRoute) respond(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if r.handler != nil {
+		return r.handler(req)
+	}
+
+	return newResponse(req, &RecordedResponse{
+		StatusCode: r.status,
+		Header:     r.resHeader,
+		Body:       r.resBody,
+	}), nil
+}
+
+func containsAll(values []string, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, v := range values {
+			if v == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
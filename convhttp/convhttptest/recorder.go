@@ -0,0 +1,319 @@
+package convhttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// ErrInteractionNotFound is returned by the Recorder in ModeReplay when no recorded
+// interaction matches the request.
+var ErrInteractionNotFound = errors.New("convhttptest: recorded interaction not found")
+
+// Mode is the mode of Recorder.
+type Mode int
+
+const (
+	// ModeReplay serves the requests with the recorded interactions only, and never
+	// sends real requests.
+	ModeReplay Mode = iota
+	// ModeRecord sends all the requests, and overwrites the cassette with the
+	// interactions on Stop.
+	ModeRecord
+	// ModeReplayOrRecord serves the requests with the recorded interactions, and sends
+	// and records the ones not recorded, which are appended to the cassette on Stop.
+	ModeReplayOrRecord
+)
+
+// MatchField is a field of requests matched against the recorded ones.
+type MatchField int
+
+const (
+	// MatchMethod matches the request methods.
+	MatchMethod MatchField = iota
+	// MatchURL matches the scheme, host and path of the request URLs.
+	MatchURL
+	// MatchQuery matches the query parameters regardless of their order.
+	MatchQuery
+	// MatchBody matches the request bodies, JSON bodies are compared semantically.
+	MatchBody
+)
+
+// Matcher reports whether the request r matches the recorded request.
+type Matcher func(r *RecordedRequest, recorded *RecordedRequest) bool
+
+// MatchOn returns a Matcher matching the fields.
+func MatchOn(fields ...MatchField) Matcher {
+	return func(r *RecordedRequest, recorded *RecordedRequest) bool {
+		for _, field := range fields {
+			if !matchField(field, r, recorded) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// DefaultMatcher matches the method, URL and query of requests.
+var DefaultMatcher = MatchOn(MatchMethod, MatchURL, MatchQuery)
+
+func matchField(field MatchField, r *RecordedRequest, recorded *RecordedRequest) bool {
+	switch field {
+	case MatchMethod:
+		return r.Method == recorded.Method
+	case MatchURL, MatchQuery:
+		u1, err1 := url.Parse(r.URL)
+		u2, err2 := url.Parse(recorded.URL)
+		if err1 != nil || err2 != nil {
+			return r.URL == recorded.URL
+		}
+		if field == MatchURL {
+			return u1.Scheme == u2.Scheme && u1.Host == u2.Host && u1.Path == u2.Path
+		}
+		return reflect.DeepEqual(u1.Query(), u2.Query())
+	case MatchBody:
+		if bytes.Equal(r.Body, recorded.Body) {
+			return true
+		}
+		var v1, v2 interface{}
+		if json.Unmarshal(r.Body, &v1) != nil || json.Unmarshal(recorded.Body, &v2) != nil {
+			return false
+		}
+		return reflect.DeepEqual(v1, v2)
+	default:
+		return false
+	}
+}
+
+type recorderOptions struct {
+	transport     http.RoundTripper
+	matcher       Matcher
+	filterHeaders []string
+}
+
+// Option configs the Recorder.
+type Option func(o *recorderOptions)
+
+// WithTransport specifies the transport sending the real requests, http.DefaultTransport
+// by default.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *recorderOptions) {
+		o.transport = transport
+	}
+}
+
+// WithMatcher specifies how the requests are matched against the recorded ones,
+// DefaultMatcher by default.
+func WithMatcher(matcher Matcher) Option {
+	return func(o *recorderOptions) {
+		o.matcher = matcher
+	}
+}
+
+// WithFilterHeaders specifies the request headers not to be recorded, so that secrets
+// are not saved to the cassettes, "Authorization" by default.
+func WithFilterHeaders(keys ...string) Option {
+	return func(o *recorderOptions) {
+		o.filterHeaders = keys
+	}
+}
+
+// Recorder is an http.RoundTripper recording the HTTP interactions to a cassette file,
+// and replaying them. The recorded interactions are replayed in order, each of them
+// serves a single request, except that the last matched one serves the requests
+// after all the matched ones are used.
+//
+//	recorder, err := convhttptest.NewRecorder("testdata/users.json", convhttptest.ModeReplayOrRecord)
+//	...
+//	defer recorder.Stop()
+//	client := convhttp.NewClient(convhttp.WithHTTPClient(recorder.Client()))
+type Recorder struct {
+	path string
+	mode Mode
+	opts recorderOptions
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     map[*Interaction]bool
+	recorded bool
+}
+
+// NewRecorder returns a Recorder with the cassette file path. The cassette is loaded
+// in ModeReplay and ModeReplayOrRecord, and it's not an error that the file doesn't
+// exist in ModeReplayOrRecord.
+func NewRecorder(path string, mode Mode, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path: path,
+		mode: mode,
+		opts: recorderOptions{
+			transport:     http.DefaultTransport,
+			matcher:       DefaultMatcher,
+			filterHeaders: []string{"Authorization"},
+		},
+		cassette: &Cassette{},
+		used:     make(map[*Interaction]bool),
+	}
+
+	for _, opt := range opts {
+		opt(&r.opts)
+	}
+
+	if mode == ModeRecord {
+		return r, nil
+	}
+
+	cassette, err := LoadCassette(path)
+	switch {
+	case err == nil:
+		r.cassette = cassette
+	case mode == ModeReplayOrRecord && errors.Is(err, os.ErrNotExist):
+	default:
+		return nil, fmt.Errorf("failed to load cassette %s: %w", path, err)
+	}
+
+	return r, nil
+}
+
+// Client returns an http client using the recorder as its transport.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := &RecordedRequest{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+		Body:   body,
+	}
+	for _, key := range r.opts.filterHeaders {
+		recorded.Header.Del(key)
+	}
+
+	if r.mode != ModeRecord {
+		if interaction := r.match(recorded); interaction != nil {
+			return newResponse(req, interaction.Response), nil
+		}
+
+		if r.mode == ModeReplay {
+			return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, req.Method, req.URL)
+		}
+	}
+
+	res, err := r.opts.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	interaction := &Interaction{
+		Request: recorded,
+		Response: &RecordedResponse{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Header:     res.Header.Clone(),
+			Body:       resBody,
+		},
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.used[interaction] = true
+	r.recorded = true
+	r.mu.Unlock()
+
+	return res, nil
+}
+
+// match returns the first unused interaction matching the request, or the last
+// matched one if all of them are used.
+func (r *Recorder) match(req *RecordedRequest) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var last *Interaction
+	for _, interaction := range r.cassette.Interactions {
+		if !r.opts.matcher(req, interaction.Request) {
+			continue
+		}
+
+		if !r.used[interaction] {
+			r.used[interaction] = true
+			return interaction
+		}
+		last = interaction
+	}
+
+	return last
+}
+
+// Stop saves the cassette if any interaction has been recorded.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.recorded {
+		return nil
+	}
+
+	return r.cassette.Save(r.path)
+}
+
+// readRequestBody reads the request body, and restores it for sending.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func newResponse(req *http.Request, recorded *RecordedResponse) *http.Response {
+	status := recorded.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode))
+	}
+
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        status,
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,63 @@
+package convhttp
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// maxErrorBodySize is the maximum size of the response body kept in HTTPError.
+const maxErrorBodySize = 512
+
+// HTTPError is returned when the server responds with a non-2xx status.
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+	// Body is an excerpt of the response body, at most 512 bytes.
+	Body []byte
+}
+
+// Error implements the error interface.
+func (e *HTTPError) Error() string {
+	if len(e.Body) == 0 {
+		return fmt.Sprintf("http: %s %s: %s", e.Method, e.URL, e.Status)
+	}
+
+	return fmt.Sprintf("http: %s %s: %s: %s", e.Method, e.URL, e.Status, e.Body)
+}
+
+func newHTTPError(resp *Response) *HTTPError {
+	body := truncateUTF8(resp.Body, maxErrorBodySize)
+
+	e := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Header:     resp.Header,
+		Body:       append([]byte(nil), body...),
+	}
+
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.URL = resp.Request.URL
+	}
+
+	return e
+}
+
+// CheckStatus returns *HTTPError if the response status is not 2xx. The error is kept
+// in the response, so that it's returned by the chained calls as well:
+//
+//	err := client.Do(opts).CheckStatus().ShouldBindJSON(&out)
+func (resp *Response) CheckStatus() *Response {
+	if resp.err != nil || resp.Response == nil {
+		return resp
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.err = newHTTPError(resp)
+	}
+
+	return resp
+}
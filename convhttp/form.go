@@ -1,14 +1,22 @@
 package convhttp
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
 	"net/url"
+	"strings"
+	"sync"
 )
 
-// FormData form data
+// FormData form data, it's encoded as multipart/form-data if it has files, or
+// application/x-www-form-urlencoded otherwise.
 type FormData struct {
 	url.Values
-	file *formFile
+	files []*formFile
 }
 
 // NewFormData new from data instance
@@ -19,38 +27,138 @@ func NewFormData() *FormData {
 }
 
 type formFile struct {
-	fieldname string
-	filename  string
-	data      []byte
+	fieldname   string
+	filename    string
+	contentType string
+	data        []byte
+
+	// reader is the content of file if data is nil, it's re-read from offset for
+	// every attempt of request if it's an io.Seeker, or read only once otherwise.
+	reader io.Reader
+	offset int64
+	mu     sync.Mutex
+	read   bool
 }
 
 func (ff *formFile) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&struct {
-		FieldName string `json:"field_name"`
-		Filename  string `json:"file_name"`
+		FieldName   string `json:"field_name"`
+		Filename    string `json:"file_name"`
+		ContentType string `json:"content_type,omitempty"`
 	}{
-		FieldName: ff.fieldname,
-		Filename:  ff.filename,
+		FieldName:   ff.fieldname,
+		Filename:    ff.filename,
+		ContentType: ff.contentType,
 	})
 }
 
-// WithFile with file
+// open returns the reader of the file content.
+func (ff *formFile) open() (io.Reader, error) {
+	if ff.reader == nil {
+		return bytes.NewReader(ff.data), nil
+	}
+
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+
+	if seeker, ok := ff.reader.(io.Seeker); ok {
+		if _, err := seeker.Seek(ff.offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return ff.reader, nil
+	}
+
+	if ff.read {
+		return nil, fmt.Errorf("form file %s could not be read again", ff.filename)
+	}
+	ff.read = true
+
+	return ff.reader, nil
+}
+
+// WithFile adds a file with content data.
 func (fd *FormData) WithFile(fieldname string, filename string, data []byte) {
-	fd.file = &formFile{
+	fd.files = append(fd.files, &formFile{
 		fieldname: fieldname,
 		filename:  filename,
 		data:      data,
+	})
+}
+
+// AddFile adds a file with content read from r, contentType is "application/octet-stream"
+// if it's empty. The content is streamed while sending the request, without buffering
+// the whole file in memory. If r is an io.Seeker, it's read from its current offset for
+// every attempt of the request, otherwise it could be read only once, and retrying the
+// request fails.
+func (fd *FormData) AddFile(fieldname string, filename string, contentType string, r io.Reader) error {
+	ff := &formFile{
+		fieldname:   fieldname,
+		filename:    filename,
+		contentType: contentType,
+		reader:      r,
 	}
+
+	if seeker, ok := r.(io.Seeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		ff.offset = offset
+	}
+
+	fd.files = append(fd.files, ff)
+	return nil
 }
 
 // MarshalJSON implements MarshalJSON method
 // to produce JSON.
 func (fd *FormData) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&struct {
-		Fileds url.Values `json:"fileds"`
-		File   *formFile  `json:"file,omitempty"`
+		Fileds url.Values  `json:"fileds"`
+		Files  []*formFile `json:"files,omitempty"`
 	}{
 		Fileds: fd.Values,
-		File:   fd.file,
+		Files:  fd.files,
 	})
 }
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// writeMultipart writes the fields and files into w.
+func (fd *FormData) writeMultipart(w *multipart.Writer) error {
+	for k, vs := range fd.Values {
+		for index := range vs {
+			if err := w.WriteField(k, vs[index]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range fd.files {
+		contentType := file.contentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			quoteEscaper.Replace(file.fieldname), quoteEscaper.Replace(file.filename)))
+		header.Set("Content-Type", contentType)
+
+		fw, err := w.CreatePart(header)
+		if err != nil {
+			return err
+		}
+
+		r, err := file.open()
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.Copy(fw, r); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
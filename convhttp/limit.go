@@ -0,0 +1,319 @@
+package convhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrThrottled is returned without sending the request when a fail-fast limit is hit.
+var ErrThrottled = errors.New("convhttp: request throttled")
+
+// LimitRule limits the rate and concurrency of the requests it matches. A rule without
+// Host and Path matches all requests, that is, a global limit.
+type LimitRule struct {
+	// Name identifies the rule in errors and Throttle, "host+path" by default.
+	Name string
+	// Host matches the host of the request URL, including the port if any, "" matches all hosts.
+	Host string
+	// Path matches the path of the request URL with path.Match syntax, except that a
+	// pattern ending with "*" matches all paths with the prefix, for example, "/v1/users/*"
+	// matches "/v1/users/1/orders". "" matches all paths.
+	Path string
+	// PerHost applies the limits to each host separately, instead of to all the matched
+	// requests together.
+	PerHost bool
+	// Rate is the number of requests allowed per second, 0 means no rate limit.
+	Rate float64
+	// Burst is the maximum number of requests allowed at once, ceil(Rate) by default.
+	Burst int
+	// MaxInFlight is the maximum number of concurrent requests, 0 means no limit.
+	MaxInFlight int
+	// FailFast fails the requests with ErrThrottled when the limits are hit, instead of
+	// waiting until the limits allow or the context of the request is done.
+	FailFast bool
+}
+
+// WithLimits returns a ClientOption that limits the requests by the rules, all the
+// matched rules apply to a request. The limits are acquired before request interceptors
+// are called, which could see the throttling by RequestOptions.Throttle, and they're
+// held until the response is read. Every retry of a request acquires them again.
+//
+// A request rejected by a fail-fast limit is never sent, request interceptors are not
+// called for it, while response interceptors are called with the response whose
+// embedded *http.Response is nil, and Response.Throttle reports the rejection.
+func WithLimits(rules ...LimitRule) ClientOption {
+	return func(c *Client) {
+		for _, rule := range rules {
+			c.limiters = append(c.limiters, newRuleLimiter(rule))
+		}
+	}
+}
+
+// Throttle describes how a request was throttled by the limits of the client.
+type Throttle struct {
+	// Waited is the time waited for the limits, by all the attempts of the request.
+	Waited time.Duration
+	// Rejected reports whether the request was rejected by a fail-fast limit.
+	Rejected bool
+	// Rules are the names of the rules that delayed or rejected the request.
+	Rules []string
+}
+
+func (t *Throttle) addRule(name string) {
+	for _, rule := range t.Rules {
+		if rule == name {
+			return
+		}
+	}
+	t.Rules = append(t.Rules, name)
+}
+
+// Throttle returns how the request was throttled by the limits of the client.
+func (opts *RequestOptions) Throttle() Throttle {
+	return opts.throttle
+}
+
+// Throttle returns how the request of the response was throttled by the limits of the client.
+func (resp *Response) Throttle() Throttle {
+	if resp.Request == nil {
+		return Throttle{}
+	}
+	return resp.Request.throttle
+}
+
+// acquireLimits acquires all the limits matching the request, it returns a function
+// releasing them.
+func (c *Client) acquireLimits(opts *RequestOptions) (func(), error) {
+	if len(c.limiters) == 0 {
+		return func() {}, nil
+	}
+
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		// let the request fail as it does without limits
+		return func() {}, nil
+	}
+
+	ctx := opts.Context()
+	start := time.Now()
+	throttled := false
+
+	var releases []func()
+	release := func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+
+	for _, rl := range c.limiters {
+		if !rl.match(u) {
+			continue
+		}
+
+		waited, r, err := rl.limiter(u.Host).acquire(ctx, rl.rule.FailFast)
+		if waited > 0 || errors.Is(err, ErrThrottled) {
+			opts.throttle.addRule(rl.name)
+			throttled = true
+		}
+
+		if err != nil {
+			release()
+			opts.throttle.Waited += time.Since(start)
+			opts.throttle.Rejected = errors.Is(err, ErrThrottled)
+			return nil, err
+		}
+
+		releases = append(releases, r)
+	}
+
+	if throttled {
+		opts.throttle.Waited += time.Since(start)
+	}
+
+	return release, nil
+}
+
+// ruleLimiter holds the limiters of a rule.
+type ruleLimiter struct {
+	rule LimitRule
+	name string
+
+	mu       sync.Mutex
+	limiters map[string]*limiter // by host if PerHost, or by ""
+}
+
+func newRuleLimiter(rule LimitRule) *ruleLimiter {
+	name := rule.Name
+	if name == "" {
+		name = rule.Host + rule.Path
+	}
+	if name == "" {
+		name = "global"
+	}
+
+	return &ruleLimiter{
+		rule:     rule,
+		name:     name,
+		limiters: make(map[string]*limiter),
+	}
+}
+
+func (rl *ruleLimiter) match(u *url.URL) bool {
+	if rl.rule.Host != "" && !strings.EqualFold(rl.rule.Host, u.Host) {
+		return false
+	}
+
+	pattern := rl.rule.Path
+	if pattern == "" {
+		return true
+	}
+
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(p, strings.TrimSuffix(pattern, "*"))
+	}
+
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+func (rl *ruleLimiter) limiter(host string) *limiter {
+	if !rl.rule.PerHost {
+		host = ""
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	l, ok := rl.limiters[host]
+	if !ok {
+		l = newLimiter(rl.name, rl.rule)
+		rl.limiters[host] = l
+	}
+
+	return l
+}
+
+// limiter is a token bucket and a semaphore.
+type limiter struct {
+	name   string
+	bucket *tokenBucket
+	sem    chan struct{}
+}
+
+func newLimiter(name string, rule LimitRule) *limiter {
+	l := &limiter{name: name}
+
+	if rule.Rate > 0 {
+		burst := rule.Burst
+		if burst <= 0 {
+			burst = int(math.Ceil(rule.Rate))
+		}
+		l.bucket = &tokenBucket{rate: rule.Rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+	}
+
+	if rule.MaxInFlight > 0 {
+		l.sem = make(chan struct{}, rule.MaxInFlight)
+	}
+
+	return l
+}
+
+// acquire takes a token and a slot of in-flight requests, it returns the time waited
+// and the function to release the slot.
+func (l *limiter) acquire(ctx context.Context, failFast bool) (time.Duration, func(), error) {
+	var waited time.Duration
+
+	if l.bucket != nil {
+		wait, ok := l.bucket.reserve(time.Now(), failFast)
+		if !ok {
+			return 0, nil, fmt.Errorf("%w: rate limit %s exceeded", ErrThrottled, l.name)
+		}
+
+		if wait > 0 {
+			start := time.Now()
+			err := sleepContext(ctx, wait)
+			waited = time.Since(start)
+			if err != nil {
+				l.bucket.cancel()
+				return waited, nil, err
+			}
+		}
+	}
+
+	if l.sem == nil {
+		return waited, func() {}, nil
+	}
+
+	release := func() { <-l.sem }
+	select {
+	case l.sem <- struct{}{}:
+		return waited, release, nil
+	default:
+	}
+
+	if failFast {
+		return waited, nil, fmt.Errorf("%w: too many in-flight requests for %s", ErrThrottled, l.name)
+	}
+
+	start := time.Now()
+	select {
+	case l.sem <- struct{}{}:
+		return waited + time.Since(start), release, nil
+	case <-ctx.Done():
+		return waited + time.Since(start), nil, ctx.Err()
+	}
+}
+
+// tokenBucket is a token bucket rate limiter. Tokens could be reserved in advance,
+// which makes the number of tokens negative, and the waiters are served in order.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token, and returns how long to wait until the token is available.
+// With failFast, it takes the token only if it's available now.
+func (b *tokenBucket) reserve(now time.Time, failFast bool) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	if failFast {
+		return 0, false
+	}
+
+	b.tokens--
+	return time.Duration(-b.tokens / b.rate * float64(time.Second)), true
+}
+
+// cancel returns a reserved token that's not used.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
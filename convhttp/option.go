@@ -46,3 +46,11 @@ func WithHTTPClient(hc *http.Client) ClientOption {
 		c.httpClient = hc
 	}
 }
+
+// WithEncoder returns a ClientOption that specifies the default encoder of request
+// bodies, see RequestOptions.Encoder.
+func WithEncoder(encoder Encoder) ClientOption {
+	return func(c *Client) {
+		c.encoder = encoder
+	}
+}
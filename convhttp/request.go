@@ -0,0 +1,169 @@
+package convhttp
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RequestBuilder builds a request fluently, and sends it with Client.Do.
+//
+//	var user User
+//	err := client.NewRequest(http.MethodGet, "https://example.com/users").
+//		Context(ctx).
+//		Query("id", "1").
+//		Header("X-Request-Id", requestID).
+//		Into(&user)
+type RequestBuilder struct {
+	client *Client
+	opts   *RequestOptions
+}
+
+// NewRequest returns a builder of request with method and URL.
+func (c *Client) NewRequest(method string, rawURL string) *RequestBuilder {
+	return &RequestBuilder{
+		client: c,
+		opts: &RequestOptions{
+			Method: method,
+			URL:    rawURL,
+			Header: http.Header{},
+			Query:  url.Values{},
+		},
+	}
+}
+
+// Context sets the context of the request.
+func (b *RequestBuilder) Context(ctx context.Context) *RequestBuilder {
+	b.opts.ctx = ctx
+	return b
+}
+
+// Timeout sets the timeout of the request, see RequestOptions.Timeout.
+func (b *RequestBuilder) Timeout(timeout time.Duration) *RequestBuilder {
+	b.opts.Timeout = timeout
+	return b
+}
+
+// Header sets the request header key to value.
+func (b *RequestBuilder) Header(key string, value string) *RequestBuilder {
+	b.opts.Header.Set(key, value)
+	return b
+}
+
+// Query adds value to the query parameter key.
+func (b *RequestBuilder) Query(key string, value string) *RequestBuilder {
+	b.opts.Query.Add(key, value)
+	return b
+}
+
+// Queries adds all the values to the query parameters.
+func (b *RequestBuilder) Queries(values url.Values) *RequestBuilder {
+	for key, vs := range values {
+		for _, v := range vs {
+			b.opts.Query.Add(key, v)
+		}
+	}
+	return b
+}
+
+// Body sets the request body, see RequestOptions.Request for the supported types.
+func (b *RequestBuilder) Body(body interface{}) *RequestBuilder {
+	b.opts.Request = body
+	return b
+}
+
+// JSON sets the request body to be encoded as JSON.
+func (b *RequestBuilder) JSON(body interface{}) *RequestBuilder {
+	b.opts.Header.Set("Content-Type", "application/json")
+	b.opts.Encoder = &JSONBinder{}
+	b.opts.Request = body
+	return b
+}
+
+// Encoder sets the encoder of the request body, see RequestOptions.Encoder.
+func (b *RequestBuilder) Encoder(encoder Encoder) *RequestBuilder {
+	b.opts.Encoder = encoder
+	return b
+}
+
+// Options returns the request options built so far.
+func (b *RequestBuilder) Options() *RequestOptions {
+	return b.opts
+}
+
+// Do sends the request with Client.Do.
+func (b *RequestBuilder) Do() *Response {
+	return b.client.Do(b.opts)
+}
+
+// Into sends the request, and binds the JSON response body into out. It returns
+// *HTTPError if the response status is not 2xx. The response body is not bound if
+// out is nil or the body is empty.
+func (b *RequestBuilder) Into(out interface{}) error {
+	resp := b.Do().CheckStatus()
+	if resp.err != nil {
+		return resp.err
+	}
+
+	if out == nil || len(resp.Body) == 0 {
+		return nil
+	}
+
+	return resp.ShouldBindJSON(out)
+}
+
+// Get sends a GET request with query, and binds the JSON response body into out.
+func (c *Client) Get(ctx context.Context, rawURL string, query url.Values, out interface{}) error {
+	return c.NewRequest(http.MethodGet, rawURL).
+		Context(ctx).
+		Header("Accept", "application/json").
+		Queries(query).
+		Into(out)
+}
+
+// PostJSON sends a POST request with in encoded as JSON, and binds the JSON response body into out.
+func (c *Client) PostJSON(ctx context.Context, rawURL string, in interface{}, out interface{}) error {
+	return c.NewRequest(http.MethodPost, rawURL).
+		Context(ctx).
+		Header("Accept", "application/json").
+		JSON(in).
+		Into(out)
+}
+
+// PutJSON sends a PUT request with in encoded as JSON, and binds the JSON response body into out.
+func (c *Client) PutJSON(ctx context.Context, rawURL string, in interface{}, out interface{}) error {
+	return c.NewRequest(http.MethodPut, rawURL).
+		Context(ctx).
+		Header("Accept", "application/json").
+		JSON(in).
+		Into(out)
+}
+
+// Delete sends a DELETE request, and binds the JSON response body into out.
+func (c *Client) Delete(ctx context.Context, rawURL string, out interface{}) error {
+	return c.NewRequest(http.MethodDelete, rawURL).
+		Context(ctx).
+		Header("Accept", "application/json").
+		Into(out)
+}
+
+// Get calls DefaultClient.Get.
+func Get(ctx context.Context, rawURL string, query url.Values, out interface{}) error {
+	return DefaultClient.Get(ctx, rawURL, query, out)
+}
+
+// PostJSON calls DefaultClient.PostJSON.
+func PostJSON(ctx context.Context, rawURL string, in interface{}, out interface{}) error {
+	return DefaultClient.PostJSON(ctx, rawURL, in, out)
+}
+
+// PutJSON calls DefaultClient.PutJSON.
+func PutJSON(ctx context.Context, rawURL string, in interface{}, out interface{}) error {
+	return DefaultClient.PutJSON(ctx, rawURL, in, out)
+}
+
+// Delete calls DefaultClient.Delete.
+func Delete(ctx context.Context, rawURL string, out interface{}) error {
+	return DefaultClient.Delete(ctx, rawURL, out)
+}
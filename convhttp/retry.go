@@ -0,0 +1,277 @@
+package convhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetryPolicy specifies when and how to retry failed requests.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one,
+	// the request is not retried if it's less than 2.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, 100ms by default.
+	InitialBackoff time.Duration
+	// MaxBackoff limits the delay between attempts, including the one specified by
+	// Retry-After header, 10s by default.
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after each retry, 2 by default.
+	Multiplier float64
+	// Jitter randomizes the delays by up to ±Jitter of them, 0.2 by default, which
+	// avoids clients retrying in lockstep. Negative Jitter disables randomization.
+	Jitter float64
+	// RetryableStatusCodes are the response statuses to be retried, 429, 502, 503
+	// and 504 by default.
+	RetryableStatusCodes []int
+	// RetryNonIdempotent allows retrying the requests with non-idempotent methods,
+	// such as POST and PATCH. Without it, such requests are retried only if they have
+	// the Idempotency-Key header.
+	RetryNonIdempotent bool
+	// ShouldRetry overrides the default retry conditions if specified. It's called
+	// with the response and error of an attempt, and the idempotency rules still apply.
+	ShouldRetry func(resp *Response, err error) bool
+}
+
+// DefaultRetryPolicy returns a policy that makes at most 3 attempts with the default settings.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: 3}
+}
+
+// WithRetryPolicy returns a ClientOption that specifies the retry policy. Every
+// attempt rebuilds the request, is limited by RequestOptions.Timeout separately, and
+// acquires the limits of WithLimits again. Request interceptors are called once before
+// the first attempt, and response interceptors are called once with the response of
+// the last attempt.
+func WithRetryPolicy(policy *RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// retryable reports whether the request is allowed to be retried by its method.
+func (p *RetryPolicy) retryable(opts *RequestOptions) bool {
+	if p == nil || p.MaxAttempts < 2 {
+		return false
+	}
+
+	method := opts.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	return p.RetryNonIdempotent || idempotentMethods[method] || opts.Header.Get("Idempotency-Key") != ""
+}
+
+// shouldRetry reports whether the attempt should be retried.
+func (p *RetryPolicy) shouldRetry(resp *Response, err error) bool {
+	if p.ShouldRetry != nil {
+		return p.ShouldRetry(resp, err)
+	}
+
+	if err != nil {
+		return isTransientError(err)
+	}
+
+	statusCodes := p.RetryableStatusCodes
+	if statusCodes == nil {
+		statusCodes = []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		}
+	}
+
+	for _, code := range statusCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isTransientError reports whether err is caused by network failures, such as
+// connection resets and timeouts. Other errors of http client, such as TLS failures,
+// unsupported schemes and redirect policy errors, are permanent.
+func isTransientError(err error) bool {
+	// *url.Error wraps all the errors of http client, and it implements net.Error itself
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// backoff returns the delay before the given retry, which starts from 1.
+func (p *RetryPolicy) backoff(retry int, resp *Response) time.Duration {
+	initial, max, multiplier, jitter := p.InitialBackoff, p.MaxBackoff, p.Multiplier, p.Jitter
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	if jitter == 0 {
+		jitter = 0.2
+	}
+
+	if d, ok := retryAfter(resp); ok {
+		if d > max {
+			d = max
+		}
+		return d
+	}
+
+	d := float64(initial) * math.Pow(multiplier, float64(retry-1))
+	if jitter > 0 {
+		d *= 1 - jitter + 2*jitter*rand.Float64()
+	}
+
+	if d > float64(max) {
+		return max
+	}
+	return time.Duration(d)
+}
+
+// retryAfter parses the Retry-After header, in either seconds or HTTP date.
+func retryAfter(resp *Response) (time.Duration, bool) {
+	if resp == nil || resp.Response == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// doWithRetry sends the request, and retries it according to the retry policy. release
+// releases the limits acquired for the first attempt, the retries acquire them again.
+func (c *Client) doWithRetry(opts *RequestOptions, release func()) (resp *Response) {
+	defer func() {
+		if release == nil {
+			return
+		}
+
+		if resp != nil && resp.stream != nil && resp.err == nil {
+			// the limits are held until the caller closes the body
+			resp.stream.closers = append(resp.stream.closers, release)
+			return
+		}
+
+		release()
+	}()
+
+	policy := c.retryPolicy
+	if !policy.retryable(opts) {
+		resp = c.attempt(opts)
+		resp.Attempts = 1
+		return resp
+	}
+
+	ctx := opts.Context()
+	for attempt := 1; ; attempt++ {
+		if release == nil {
+			var err error
+			if release, err = c.acquireLimits(opts); err != nil {
+				return &Response{Request: opts, err: err, Attempts: attempt - 1}
+			}
+		}
+
+		resp = c.attempt(opts)
+		resp.Attempts = attempt
+
+		if attempt >= policy.MaxAttempts || ctx.Err() != nil || !policy.shouldRetry(resp, resp.err) {
+			return resp
+		}
+
+		resp.closeStream()
+		release()
+		release = nil
+
+		delay := policy.backoff(attempt, resp)
+		if c.Logger != nil {
+			config := c.accessLogConfig()
+			fields := append(metadataFields(ctx),
+				zap.String("method", opts.Method),
+				zap.String("url", config.redactURL(opts.URL, opts.Query)),
+				zap.Int("attempt", attempt),
+				zap.Duration("delay", delay),
+				zap.Int("status", resp.statusCode()))
+			if resp.err != nil {
+				fields = append(fields, zap.String("error", config.redactError(resp.err, opts)))
+			}
+			c.Logger.Warn("retry request", fields...)
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			resp.err = err
+			return resp
+		}
+	}
+}
+
+func (resp *Response) statusCode() int {
+	if resp.Response == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+// sleepContext sleeps for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
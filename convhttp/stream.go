@@ -0,0 +1,304 @@
+package convhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBodyTooLarge is returned when the response body exceeds the size specified by WithMaxBodySize.
+var ErrBodyTooLarge = errors.New("convhttp: response body too large")
+
+// WithMaxBodySize returns a ClientOption that limits the size of the response bodies
+// read into Response.Body, 0 means no limit. It doesn't apply to streaming responses.
+func WithMaxBodySize(size int64) ClientOption {
+	return func(c *Client) {
+		c.maxBodySize = size
+	}
+}
+
+// readBody reads the response body into memory.
+func (c *Client) readBody(res *http.Response) ([]byte, error) {
+	if c.maxBodySize <= 0 {
+		return ioutil.ReadAll(res.Body)
+	}
+
+	if res.ContentLength > c.maxBodySize {
+		return nil, fmt.Errorf("%w: content length %d exceeds %d", ErrBodyTooLarge, res.ContentLength, c.maxBodySize)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, c.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > c.maxBodySize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, c.maxBodySize)
+	}
+
+	return data, nil
+}
+
+// streamBody is the unread response body, the closers are called once it's closed.
+type streamBody struct {
+	io.ReadCloser
+	closers []func()
+	once    sync.Once
+}
+
+func (b *streamBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		for _, closer := range b.closers {
+			closer()
+		}
+	})
+	return err
+}
+
+func (resp *Response) closeStream() {
+	if resp.stream != nil {
+		resp.stream.Close()
+	}
+}
+
+// Stream returns the response body of a request sent with RequestOptions.Stream, the
+// caller must close it, which releases the resources of the request. It returns the
+// buffered body if the request is not in streaming mode.
+func (resp *Response) Stream() (io.ReadCloser, error) {
+	if resp.err != nil {
+		return nil, resp.err
+	}
+
+	if resp.stream != nil {
+		return resp.stream, nil
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(resp.Body)), nil
+}
+
+// NDJSONDecoder decodes the values of a newline delimited JSON stream one by one.
+type NDJSONDecoder struct {
+	body io.ReadCloser
+	dec  *json.Decoder
+	err  error
+}
+
+// NDJSON returns a decoder of the NDJSON response body, the caller must close it.
+func (resp *Response) NDJSON() *NDJSONDecoder {
+	body, err := resp.Stream()
+	if err != nil {
+		return &NDJSONDecoder{err: err}
+	}
+
+	return &NDJSONDecoder{body: body, dec: json.NewDecoder(body)}
+}
+
+// Next decodes the next value into v, it returns io.EOF at the end of the stream.
+func (d *NDJSONDecoder) Next(v interface{}) error {
+	if d.err != nil {
+		return d.err
+	}
+
+	return d.dec.Decode(v)
+}
+
+// Close closes the response body.
+func (d *NDJSONDecoder) Close() error {
+	if d.body == nil {
+		return nil
+	}
+	return d.body.Close()
+}
+
+// Event is a server-sent event.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	// Retry is the reconnection time sent by server, 0 if it's not specified.
+	Retry time.Duration
+}
+
+// EventReader reads server-sent events from the response body, see
+// https://html.spec.whatwg.org/multipage/server-sent-events.html.
+type EventReader struct {
+	body   io.ReadCloser
+	r      *bufio.Reader
+	err    error
+	lastID string
+}
+
+// Events returns a reader of the server-sent events in the response body, the caller
+// must close it.
+func (resp *Response) Events() *EventReader {
+	body, err := resp.Stream()
+	if err != nil {
+		return &EventReader{err: err}
+	}
+
+	return &EventReader{body: body, r: bufio.NewReader(body)}
+}
+
+// Next returns the next event, it returns io.EOF at the end of the stream.
+func (er *EventReader) Next() (*Event, error) {
+	if er.err != nil {
+		return nil, er.err
+	}
+
+	event := &Event{}
+	var data []string
+	var hasData bool
+
+	for {
+		line, err := er.r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			// an incomplete event at the end of stream is discarded
+			er.err = err
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if !hasData {
+				// an event without data is not dispatched
+				event, data = &Event{}, nil
+				continue
+			}
+
+			event.ID = er.lastID
+			event.Data = strings.Join(data, "\n")
+			return event, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			// comment
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				er.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// Close closes the response body.
+func (er *EventReader) Close() error {
+	if er.body == nil {
+		return nil
+	}
+	return er.body.Close()
+}
+
+// DownloadToFile downloads the response body of request into file filePath, and returns
+// the size of file. If the file exists, it resumes the download from the end of file
+// with Range header, and downloads the whole file again if the server doesn't support
+// ranges. The downloaded part is kept if it fails, so that it could be resumed by
+// calling DownloadToFile again. It returns *HTTPError if the status is not 2xx.
+func (c *Client) DownloadToFile(ctx context.Context, opts *RequestOptions, filePath string) (int64, error) {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	if opts.Header == nil {
+		opts.Header = http.Header{}
+	}
+	if offset > 0 {
+		opts.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	opts.Stream = true
+
+	resp := c.DoContext(ctx, opts)
+	body, err := resp.Stream()
+	if err != nil {
+		return offset, err
+	}
+	defer body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && rangeStart(resp.Header.Get("Content-Range")) == offset:
+		// resume from the end of file
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 &&
+		resp.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset):
+		// the file has been downloaded completely
+		return offset, nil
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299 && resp.StatusCode != http.StatusPartialContent:
+		// the server sends the whole file
+		if err := file.Truncate(0); err != nil {
+			return 0, err
+		}
+		if offset, err = file.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+	default:
+		resp.Body, _ = ioutil.ReadAll(io.LimitReader(body, maxErrorBodySize))
+		return offset, newHTTPError(resp)
+	}
+
+	n, err := io.Copy(file, body)
+	if err != nil {
+		return offset + n, err
+	}
+
+	return offset + n, file.Sync()
+}
+
+// DownloadToFile calls DefaultClient.DownloadToFile.
+func DownloadToFile(ctx context.Context, opts *RequestOptions, filePath string) (int64, error) {
+	return DefaultClient.DownloadToFile(ctx, opts, filePath)
+}
+
+// rangeStart returns the first byte position of Content-Range "bytes first-last/length",
+// or -1 if it's invalid.
+func rangeStart(contentRange string) int64 {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return -1
+	}
+
+	r := strings.TrimPrefix(contentRange, "bytes ")
+	i := strings.IndexByte(r, '-')
+	if i < 0 {
+		return -1
+	}
+
+	start, err := strconv.ParseInt(r[:i], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
@@ -5,14 +5,20 @@ go 1.16
 require (
 	github.com/gin-gonic/gin v1.7.2
 	github.com/gofrs/uuid v4.1.0+incompatible
+	github.com/golang/snappy v0.0.4
 	github.com/jinzhu/gorm v1.9.16
+	github.com/klauspost/compress v1.15.9
 	github.com/onsi/ginkgo v1.7.0 // indirect
 	github.com/onsi/gomega v1.4.3 // indirect
+	github.com/pierrec/lz4/v4 v4.1.17
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus/client_golang v1.12.2
 	github.com/swaggo/files v0.0.0-20190704085106-630677cd5c14
+	github.com/ugorji/go/codec v1.1.7
 	go.uber.org/zap v1.16.0
+	google.golang.org/protobuf v1.26.0
 	gopkg.in/redis.v5 v5.2.9
+	gopkg.in/yaml.v2 v2.4.0
 	gorm.io/gorm v1.23.10
 	gorm.io/plugin/prometheus v0.0.0-20220517015831-ca6bfaf20bf4
 )
@@ -0,0 +1,271 @@
+package mergesort
+
+import "sort"
+
+const (
+	// minMerge is the minimum length of data to be sorted by natural runs, shorter
+	// data is sorted by binary insertion sort directly.
+	minMerge = 32
+
+	// minGallop is the number of consecutive elements won by the same run before
+	// switching to galloping mode.
+	minGallop = 7
+)
+
+// AdaptiveSort sorts data in the way of Timsort. It detects the existing ascending
+// and strictly descending runs, extends short runs by binary insertion sort, and
+// merges the runs with galloping, which copies a whole slice of elements once
+// a run keeps winning.
+//
+// AdaptiveSort is stable, and it does far less comparisons than Sort on data that
+// is already partially sorted, in the best case it takes only n-1 comparisons.
+func AdaptiveSort(data Interface) {
+	n := data.Len()
+	if n < 2 {
+		return
+	}
+
+	if n < minMerge {
+		runLen := countRunAndMakeAscending(data, 0, n)
+		binaryInsertionSort(data, 0, n, runLen)
+		return
+	}
+
+	ts := &timSorter{
+		data: data,
+		temp: make([]interface{}, n),
+	}
+
+	minRun := computeMinRun(n)
+	for lo := 0; lo < n; {
+		runLen := countRunAndMakeAscending(data, lo, n)
+
+		// extend the short run to min(minRun, n-lo)
+		if runLen < minRun {
+			force := minRun
+			if n-lo < force {
+				force = n - lo
+			}
+			binaryInsertionSort(data, lo, lo+force, lo+runLen)
+			runLen = force
+		}
+
+		ts.runs = append(ts.runs, run{base: lo, len: runLen})
+		ts.mergeCollapse()
+		lo += runLen
+	}
+
+	ts.mergeForceCollapse()
+}
+
+type run struct {
+	base int
+	len  int
+}
+
+type timSorter struct {
+	data Interface
+	temp []interface{}
+	runs []run // pending runs yet to be merged
+}
+
+// mergeCollapse merges the pending runs until the stack invariants are re-established:
+//
+//	runs[n-2].len > runs[n-1].len + runs[n].len
+//	runs[n-1].len > runs[n].len
+func (ts *timSorter) mergeCollapse() {
+	for len(ts.runs) > 1 {
+		n := len(ts.runs) - 2
+		if (n > 0 && ts.runs[n-1].len <= ts.runs[n].len+ts.runs[n+1].len) ||
+			(n > 1 && ts.runs[n-2].len <= ts.runs[n-1].len+ts.runs[n].len) {
+			if ts.runs[n-1].len < ts.runs[n+1].len {
+				n--
+			}
+		} else if ts.runs[n].len > ts.runs[n+1].len {
+			break
+		}
+		ts.mergeAt(n)
+	}
+}
+
+// mergeForceCollapse merges all pending runs into one.
+func (ts *timSorter) mergeForceCollapse() {
+	for len(ts.runs) > 1 {
+		n := len(ts.runs) - 2
+		if n > 0 && ts.runs[n-1].len < ts.runs[n+1].len {
+			n--
+		}
+		ts.mergeAt(n)
+	}
+}
+
+// mergeAt merges the two runs at index i and i+1.
+func (ts *timSorter) mergeAt(i int) {
+	lo, mid := ts.runs[i].base, ts.runs[i+1].base
+	hi := mid + ts.runs[i+1].len
+
+	ts.runs[i].len += ts.runs[i+1].len
+	ts.runs = append(ts.runs[:i+1], ts.runs[i+2:]...)
+
+	data := ts.data
+
+	// elements in left run that are not greater than the first element of right run are in place already.
+	lo += gallopRight(data, mid, lo, mid-lo)
+	if lo == mid {
+		return
+	}
+
+	// elements in right run that are not less than the last element of left run are in place already.
+	hi = mid + gallopLeft(data, mid-1, mid, hi-mid)
+
+	ts.merge(lo, mid, hi)
+}
+
+// merge merges data[lo:mid] and data[mid:hi] through temp.
+func (ts *timSorter) merge(lo, mid, hi int) {
+	data, temp := ts.data, ts.temp
+	i, j, k := lo, mid, 0
+
+	for i < mid && j < hi {
+		// compare elements one by one, until a run wins minGallop times in a row.
+		leftWins, rightWins := 0, 0
+		for i < mid && j < hi && leftWins < minGallop && rightWins < minGallop {
+			if data.Less(j, i) {
+				temp[k] = data.Get(j)
+				j++
+				rightWins++
+				leftWins = 0
+			} else {
+				temp[k] = data.Get(i)
+				i++
+				leftWins++
+				rightWins = 0
+			}
+			k++
+		}
+
+		// galloping mode, copy elements in chunks, until the chunks get short again.
+		for i < mid && j < hi {
+			c := gallopRight(data, j, i, mid-i)
+			for end := i + c; i < end; i++ {
+				temp[k] = data.Get(i)
+				k++
+			}
+			if i == mid {
+				break
+			}
+
+			d := gallopLeft(data, i, j, hi-j)
+			for end := j + d; j < end; j++ {
+				temp[k] = data.Get(j)
+				k++
+			}
+
+			if c < minGallop && d < minGallop {
+				break
+			}
+		}
+	}
+
+	for ; i < mid; i++ {
+		temp[k] = data.Get(i)
+		k++
+	}
+
+	for ; j < hi; j++ {
+		temp[k] = data.Get(j)
+		k++
+	}
+
+	for x := 0; x < k; x++ {
+		data.Set(lo+x, temp[x])
+		temp[x] = nil
+	}
+}
+
+// gallopRight returns the number of elements in the sorted range data[base:base+n]
+// that are not greater than data[key].
+func gallopRight(data Interface, key, base, n int) int {
+	return gallop(n, func(p int) bool { return data.Less(key, base+p) })
+}
+
+// gallopLeft returns the number of elements in the sorted range data[base:base+n]
+// that are less than data[key].
+func gallopLeft(data Interface, key, base, n int) int {
+	return gallop(n, func(p int) bool { return !data.Less(base+p, key) })
+}
+
+// gallop returns the smallest index p in [0, n) at which f(p) is true, or n if
+// there is no such index. f must be false and then true. It probes index 0, 2, 6, 14...
+// until f is true, and then binary searches the last gap, so that it takes
+// O(log p) comparisons instead of O(log n).
+func gallop(n int, f func(p int) bool) int {
+	prev, ofs := 0, 1
+	for ofs <= n && !f(ofs-1) {
+		prev = ofs
+		ofs = ofs*2 + 1
+	}
+
+	if ofs > n {
+		ofs = n
+	}
+
+	return prev + sort.Search(ofs-prev, func(x int) bool { return f(prev + x) })
+}
+
+// computeMinRun returns the minimum run length, which makes n/minRun a power of 2
+// or slightly less than that.
+func computeMinRun(n int) int {
+	r := 0
+	for n >= minMerge {
+		r |= n & 1
+		n >>= 1
+	}
+	return n + r
+}
+
+// countRunAndMakeAscending returns the length of the run starting at lo, and reverses
+// it if it's descending. A descending run must be strictly descending to keep the
+// sorting stable.
+func countRunAndMakeAscending(data Interface, lo, hi int) int {
+	runHi := lo + 1
+	if runHi == hi {
+		return 1
+	}
+
+	if data.Less(runHi, lo) {
+		runHi++
+		for runHi < hi && data.Less(runHi, runHi-1) {
+			runHi++
+		}
+		reverseRange(data, lo, runHi)
+	} else {
+		runHi++
+		for runHi < hi && !data.Less(runHi, runHi-1) {
+			runHi++
+		}
+	}
+
+	return runHi - lo
+}
+
+func reverseRange(data Interface, lo, hi int) {
+	for hi--; lo < hi; lo, hi = lo+1, hi-1 {
+		data.Swap(lo, hi)
+	}
+}
+
+// binaryInsertionSort sorts data[lo:hi], of which data[lo:start] is sorted already.
+func binaryInsertionSort(data Interface, lo, hi, start int) {
+	if start == lo {
+		start++
+	}
+
+	for ; start < hi; start++ {
+		// insert after the equal elements to keep the sorting stable.
+		pos := lo + sort.Search(start-lo, func(p int) bool { return data.Less(start, lo+p) })
+		for j := start; j > pos; j-- {
+			data.Swap(j, j-1)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"math/rand"
+	"sort"
 
 	"github.com/jiandahao/goutils/mergesort"
 )
@@ -19,4 +21,8 @@ func main() {
 	stringData := []string{"9", "4", "2", "6", "8", "1", "3", "7", "5"}
 	mergesort.StringSlice(stringData).Sort()
 	fmt.Println(stringData)
+
+	largeData := rand.Perm(1 << 16)
+	mergesort.ParallelSort(mergesort.IntSlice(largeData), 1<<12)
+	fmt.Println(sort.IntsAreSorted(largeData))
 }
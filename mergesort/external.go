@@ -0,0 +1,398 @@
+package mergesort
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jiandahao/goutils/compress"
+	"github.com/jiandahao/goutils/container/priorityqueue"
+)
+
+// RecordCodec reads and writes the records sorted by external sort.
+type RecordCodec interface {
+	// WriteRecord writes record into w.
+	WriteRecord(w *bufio.Writer, record interface{}) error
+	// ReadRecord reads next record from r, it returns io.EOF if there are no more records.
+	ReadRecord(r *bufio.Reader) (interface{}, error)
+}
+
+// LineCodec is a RecordCodec for text lines, records are strings without the line ending.
+type LineCodec struct{}
+
+// WriteRecord writes record into w as a line.
+func (c LineCodec) WriteRecord(w *bufio.Writer, record interface{}) error {
+	if _, err := w.WriteString(record.(string)); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
+
+// ReadRecord reads next line from r.
+func (c LineCodec) ReadRecord(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		// the last line without line ending
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// ExternalOption configs external sort.
+type ExternalOption func(s *externalSorter)
+
+// WithChunkSize sets the maximum number of records sorted in memory at a time, 65536 by default.
+func WithChunkSize(size int) ExternalOption {
+	return func(s *externalSorter) {
+		if size > 0 {
+			s.chunkSize = size
+		}
+	}
+}
+
+// WithTempDir sets the directory for temporary chunk files, os.TempDir() by default.
+func WithTempDir(dir string) ExternalOption {
+	return func(s *externalSorter) {
+		s.tempDir = dir
+	}
+}
+
+// WithMaxMergeFiles sets the maximum number of chunk files merged at a time, 64 by
+// default. More chunk files are merged in multiple passes, which keeps the number of
+// open files bounded.
+func WithMaxMergeFiles(n int) ExternalOption {
+	return func(s *externalSorter) {
+		if n > 1 {
+			s.maxMergeFiles = n
+		}
+	}
+}
+
+// WithCompression makes the temporary chunk files gzip compressed, which trades CPU
+// time for less disk space and IO.
+func WithCompression() ExternalOption {
+	return func(s *externalSorter) {
+		s.compressed = true
+	}
+}
+
+// ExternalSort sorts the records read from r and writes them into w, it's for datasets
+// that are larger than memory. Records are sorted in chunks in memory, and the sorted
+// chunks are spilled into temporary files, which are merged with a heap at last.
+//
+// less is used to compare two records, it should return true if x is considered to go
+// before y. ExternalSort is stable.
+func ExternalSort(r io.Reader, w io.Writer, codec RecordCodec, less func(x, y interface{}) bool, opts ...ExternalOption) error {
+	br := bufio.NewReader(r)
+	next := func() (interface{}, error) {
+		return codec.ReadRecord(br)
+	}
+
+	return newExternalSorter(codec, less, opts...).sort(next, w)
+}
+
+// ExternalSortLines sorts the lines of file filePath in lexicographical order, and writes
+// them into w. Lines are read by LineCodec, so that there's no limit on their length.
+func ExternalSortLines(filePath string, w io.Writer, opts ...ExternalOption) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	less := func(x, y interface{}) bool {
+		return x.(string) < y.(string)
+	}
+
+	return ExternalSort(file, w, LineCodec{}, less, opts...)
+}
+
+// ExternalSortStrings sorts the strings received from records in lexicographical order,
+// and writes them into w as lines, for example, the lines of files.ReadLines:
+//
+//	lines, err := files.ReadLines(filePath)
+//	...
+//	err = mergesort.ExternalSortStrings(lines, w)
+//
+// records is drained even if sorting fails, so that its sender is not blocked.
+func ExternalSortStrings(records <-chan string, w io.Writer, opts ...ExternalOption) error {
+	next := func() (interface{}, error) {
+		record, ok := <-records
+		if !ok {
+			return nil, io.EOF
+		}
+		return record, nil
+	}
+
+	less := func(x, y interface{}) bool {
+		return x.(string) < y.(string)
+	}
+
+	err := newExternalSorter(LineCodec{}, less, opts...).sort(next, w)
+
+	for range records {
+	}
+
+	return err
+}
+
+type externalSorter struct {
+	codec         RecordCodec
+	less          func(x, y interface{}) bool
+	chunkSize     int
+	maxMergeFiles int
+	tempDir       string
+	compressed    bool
+}
+
+func newExternalSorter(codec RecordCodec, less func(x, y interface{}) bool, opts ...ExternalOption) *externalSorter {
+	s := &externalSorter{
+		codec:         codec,
+		less:          less,
+		chunkSize:     1 << 16,
+		maxMergeFiles: 64,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *externalSorter) sort(next func() (interface{}, error), w io.Writer) error {
+	var chunkFiles []string
+	defer func() {
+		for _, name := range chunkFiles {
+			os.Remove(name)
+		}
+	}()
+
+	chunk := make([]interface{}, 0, s.chunkSize)
+	for {
+		record, err := next()
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if err == nil {
+			chunk = append(chunk, record)
+			if len(chunk) < s.chunkSize {
+				continue
+			}
+		}
+
+		AdaptiveSort(&recordSorter{data: chunk, less: s.less})
+
+		if err == io.EOF && len(chunkFiles) == 0 {
+			// all records fit in memory
+			return s.writeChunk(w, chunk)
+		}
+
+		if len(chunk) > 0 {
+			name, err := s.spill(chunk)
+			if name != "" {
+				chunkFiles = append(chunkFiles, name)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		chunk = chunk[:0]
+	}
+
+	// merges consecutive chunk files into larger ones until they could be merged at a
+	// time, which keeps the sorting stable.
+	for len(chunkFiles) > s.maxMergeFiles {
+		var merged []string
+		for i := 0; i < len(chunkFiles); i += s.maxMergeFiles {
+			end := i + s.maxMergeFiles
+			if end > len(chunkFiles) {
+				end = len(chunkFiles)
+			}
+
+			name, err := s.createChunk(func(w io.Writer) error {
+				return s.merge(chunkFiles[i:end], w)
+			})
+			if name != "" {
+				merged = append(merged, name)
+			}
+			if err != nil {
+				chunkFiles = append(chunkFiles, merged...)
+				return err
+			}
+		}
+
+		for _, name := range chunkFiles {
+			os.Remove(name)
+		}
+		chunkFiles = merged
+	}
+
+	return s.merge(chunkFiles, w)
+}
+
+func (s *externalSorter) writeChunk(w io.Writer, chunk []interface{}) error {
+	bw := bufio.NewWriter(w)
+	for _, record := range chunk {
+		if err := s.codec.WriteRecord(bw, record); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// spill writes the sorted chunk into a temporary file, and returns the file name.
+func (s *externalSorter) spill(chunk []interface{}) (string, error) {
+	return s.createChunk(func(w io.Writer) error {
+		return s.writeChunk(w, chunk)
+	})
+}
+
+// createChunk creates a temporary chunk file with the records written by write, and
+// returns the file name.
+func (s *externalSorter) createChunk(write func(w io.Writer) error) (string, error) {
+	file, err := ioutil.TempFile(s.tempDir, "mergesort-*.chunk")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if !s.compressed {
+		return file.Name(), write(file)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(write(pw))
+	}()
+
+	err = compress.Compress(pr, file)
+	pr.CloseWithError(io.ErrClosedPipe) // unblock the writer if compression failed
+	return file.Name(), err
+}
+
+// chunkReader reads records from a sorted chunk file.
+type chunkReader struct {
+	file *os.File
+	r    *bufio.Reader
+	pr   *io.PipeReader
+}
+
+func (s *externalSorter) openChunk(name string) (*chunkReader, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.compressed {
+		return &chunkReader{file: file, r: bufio.NewReader(file)}, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(compress.Decompress(file, pw))
+	}()
+
+	return &chunkReader{file: file, r: bufio.NewReader(pr), pr: pr}, nil
+}
+
+func (cr *chunkReader) Close() error {
+	if cr.pr != nil {
+		cr.pr.Close()
+	}
+	return cr.file.Close()
+}
+
+// mergeItem is a record in the merging heap along with the index of its chunk.
+type mergeItem struct {
+	record interface{}
+	chunk  int
+}
+
+// merge merges the sorted chunk files with a heap, and writes the records into w.
+func (s *externalSorter) merge(chunkFiles []string, w io.Writer) error {
+	readers := make([]*chunkReader, 0, len(chunkFiles))
+	defer func() {
+		for _, cr := range readers {
+			cr.Close()
+		}
+	}()
+
+	for _, name := range chunkFiles {
+		cr, err := s.openChunk(name)
+		if err != nil {
+			return err
+		}
+		readers = append(readers, cr)
+	}
+
+	// equal records are ordered by the index of chunk to keep the sorting stable.
+	pq := priorityqueue.New(func(x, y interface{}) bool {
+		a, b := x.(*mergeItem), y.(*mergeItem)
+		if s.less(a.record, b.record) {
+			return true
+		}
+		if s.less(b.record, a.record) {
+			return false
+		}
+		return a.chunk < b.chunk
+	})
+
+	push := func(chunk int) error {
+		record, err := s.codec.ReadRecord(readers[chunk].r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		pq.Push(&mergeItem{record: record, chunk: chunk})
+		return nil
+	}
+
+	for i := range readers {
+		if err := push(i); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for pq.Len() > 0 {
+		top := pq.Pop().(*mergeItem)
+		if err := s.codec.WriteRecord(bw, top.record); err != nil {
+			return err
+		}
+
+		if err := push(top.chunk); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// recordSorter attaches the methods of Interface to records compared by less.
+type recordSorter struct {
+	data []interface{}
+	less func(x, y interface{}) bool
+}
+
+func (x *recordSorter) Len() int                   { return len(x.data) }
+func (x *recordSorter) Less(i, j int) bool         { return x.less(x.data[i], x.data[j]) }
+func (x *recordSorter) Swap(i, j int)              { x.data[i], x.data[j] = x.data[j], x.data[i] }
+func (x *recordSorter) Get(i int) interface{}      { return x.data[i] }
+func (x *recordSorter) Set(i int, val interface{}) { x.data[i] = val }
@@ -0,0 +1,361 @@
+package mergesort
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jiandahao/goutils/files"
+)
+
+func TestParallelSort(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 100, 10000, 100000} {
+		data := rand.Perm(n)
+		ParallelSort(IntSlice(data), 1000)
+		if !sort.IntsAreSorted(data) {
+			t.Fatalf("%v elements are not sorted", n)
+		}
+	}
+}
+
+// record is sorted by key, and id records the original order.
+type record struct {
+	key int
+	id  int
+}
+
+type recordSlice []record
+
+func (x recordSlice) Len() int                   { return len(x) }
+func (x recordSlice) Less(i, j int) bool         { return x[i].key < x[j].key }
+func (x recordSlice) Swap(i, j int)              { x[i], x[j] = x[j], x[i] }
+func (x recordSlice) Get(i int) interface{}      { return x[i] }
+func (x recordSlice) Set(i int, val interface{}) { x[i] = val.(record) }
+
+func isStable(x recordSlice) bool {
+	for i := 1; i < len(x); i++ {
+		if x[i].key < x[i-1].key || (x[i].key == x[i-1].key && x[i].id < x[i-1].id) {
+			return false
+		}
+	}
+	return true
+}
+
+// partiallySorted returns n ascending numbers, of which about 1% are shuffled,
+// and with a descending tail.
+func partiallySorted(n int) []int {
+	data := make([]int, n)
+	for i := range data {
+		data[i] = i
+	}
+
+	for i := 0; i < n/100; i++ {
+		x, y := rand.Intn(n), rand.Intn(n)
+		data[x], data[y] = data[y], data[x]
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(data[n-n/10:])))
+	return data
+}
+
+func TestAdaptiveSort(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 31, 32, 100, 10000, 100000} {
+		data := rand.Perm(n)
+		AdaptiveSort(IntSlice(data))
+		if !sort.IntsAreSorted(data) {
+			t.Fatalf("%v random elements are not sorted", n)
+		}
+
+		data = partiallySorted(n)
+		AdaptiveSort(IntSlice(data))
+		if !sort.IntsAreSorted(data) {
+			t.Fatalf("%v partially sorted elements are not sorted", n)
+		}
+
+		records := make(recordSlice, n)
+		for i := range records {
+			records[i] = record{key: rand.Intn(n/10 + 1), id: i}
+		}
+		AdaptiveSort(records)
+		if !isStable(records) {
+			t.Fatalf("sorting %v records is not stable", n)
+		}
+	}
+}
+
+func BenchmarkSort(b *testing.B) {
+	benchmarkSort(b, Sort)
+}
+
+func BenchmarkParallelSort(b *testing.B) {
+	benchmarkSort(b, func(data Interface) { ParallelSort(data, 0) })
+}
+
+func benchmarkSort(b *testing.B, sortFn func(data Interface)) {
+	src := rand.Perm(1 << 20)
+	data := make([]int, len(src))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copy(data, src)
+		b.StartTimer()
+		sortFn(IntSlice(data))
+	}
+}
+
+func BenchmarkSort_PartiallySorted(b *testing.B) {
+	benchmarkSortPartiallySorted(b, Sort)
+}
+
+func BenchmarkAdaptiveSort_PartiallySorted(b *testing.B) {
+	benchmarkSortPartiallySorted(b, AdaptiveSort)
+}
+
+func benchmarkSortPartiallySorted(b *testing.B, sortFn func(data Interface)) {
+	src := partiallySorted(1 << 20)
+	data := make([]int, len(src))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copy(data, src)
+		b.StartTimer()
+		sortFn(IntSlice(data))
+	}
+}
+
+type intCodec struct{}
+
+func (c intCodec) WriteRecord(w *bufio.Writer, record interface{}) error {
+	_, err := fmt.Fprintln(w, record.(int))
+	return err
+}
+
+func (c intCodec) ReadRecord(r *bufio.Reader) (interface{}, error) {
+	var n int
+	_, err := fmt.Fscanln(r, &n)
+	return n, err
+}
+
+func TestExternalSort(t *testing.T) {
+	less := func(x, y interface{}) bool {
+		return x.(int) < y.(int)
+	}
+
+	for _, opts := range [][]ExternalOption{
+		{WithChunkSize(1 << 20)},
+		{WithChunkSize(100), WithTempDir(t.TempDir())},
+		{WithChunkSize(100), WithCompression()},
+		{WithChunkSize(50), WithMaxMergeFiles(4)},
+		{WithChunkSize(50), WithMaxMergeFiles(2), WithCompression()},
+	} {
+		data := rand.Perm(10000)
+
+		var input bytes.Buffer
+		for _, n := range data {
+			fmt.Fprintln(&input, n)
+		}
+
+		var output bytes.Buffer
+		if err := ExternalSort(&input, &output, intCodec{}, less, opts...); err != nil {
+			t.Fatal(err)
+		}
+
+		sort.Ints(data)
+		for _, n := range data {
+			var got int
+			if _, err := fmt.Fscanln(&output, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != n {
+				t.Fatalf("wanted %v but got %v", n, got)
+			}
+		}
+	}
+}
+
+func TestExternalSortLines(t *testing.T) {
+	lines := make([]string, 1000)
+	for i := range lines {
+		lines[i] = strconv.Itoa(rand.Int())
+	}
+
+	filePath := filepath.Join(t.TempDir(), "lines.txt")
+	if err := ioutil.WriteFile(filePath, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	if err := ExternalSortLines(filePath, &output, WithChunkSize(64), WithCompression()); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(lines)
+	if got := strings.Join(lines, "\n") + "\n"; output.String() != got {
+		t.Fatalf("lines are not sorted")
+	}
+
+	records, err := files.ReadLines(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output.Reset()
+	if err := ExternalSortStrings(records, &output, WithChunkSize(64)); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(lines, "\n") + "\n"; output.String() != got {
+		t.Fatalf("lines of files.ReadLines are not sorted")
+	}
+}
+
+func TestExternalSort_MaxMergeFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	records := make(chan string)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			records <- strconv.Itoa(rand.Intn(100))
+		}
+		close(records)
+	}()
+
+	var output bytes.Buffer
+	if err := ExternalSortStrings(records, &output, WithChunkSize(10), WithMaxMergeFiles(3), WithTempDir(tempDir)); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 1000 || !sort.StringsAreSorted(lines) {
+		t.Fatalf("%d lines are not sorted", len(lines))
+	}
+
+	if entries, _ := ioutil.ReadDir(tempDir); len(entries) != 0 {
+		t.Fatalf("temporary chunk files should be removed, but got %d", len(entries))
+	}
+}
+
+func TestExternalSortLines_LongLine(t *testing.T) {
+	long := strings.Repeat("x", 100<<10)
+	filePath := filepath.Join(t.TempDir(), "lines.txt")
+	if err := ioutil.WriteFile(filePath, []byte("b\n"+long+"\na\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	if err := ExternalSortLines(filePath, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := "a\nb\n" + long + "\n"; output.String() != got {
+		t.Fatalf("lines longer than 64KB should be sorted completely, got %d bytes", output.Len())
+	}
+}
+
+func TestSlice(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 100, 10000} {
+		records := make([]record, n)
+		for i := range records {
+			records[i] = record{key: rand.Intn(n/10 + 1), id: i}
+		}
+
+		Slice(records, func(i, j int) bool { return records[i].key < records[j].key })
+		if !isStable(recordSlice(records)) {
+			t.Fatalf("sorting %v records is not stable", n)
+		}
+
+		ints := rand.Perm(n)
+		Ints(ints)
+		if !sort.IntsAreSorted(ints) {
+			t.Fatalf("%v ints are not sorted", n)
+		}
+
+		floats := make([]float64, n)
+		strs := make([]string, n)
+		for i := range floats {
+			floats[i] = rand.NormFloat64()
+			if i%7 == 0 {
+				floats[i] = math.NaN()
+			}
+			strs[i] = strconv.Itoa(rand.Intn(n))
+		}
+		Float64s(floats)
+		if !sort.Float64sAreSorted(floats) {
+			t.Fatalf("%v float64s are not sorted", n)
+		}
+		Strings(strs)
+		if !sort.StringsAreSorted(strs) {
+			t.Fatalf("%v strings are not sorted", n)
+		}
+	}
+
+	people := []struct {
+		name string
+		age  int
+	}{{"c", 30}, {"b", 20}, {"a", 30}, {"d", 20}}
+
+	Slice(people, MultiKey(
+		func(i, j int) bool { return people[i].age < people[j].age },
+		func(i, j int) bool { return people[i].name > people[j].name },
+	))
+
+	var names string
+	for _, p := range people {
+		names += p.name
+	}
+	if names != "dbca" {
+		t.Fatalf("wanted dbca but got %v", names)
+	}
+}
+
+func TestSlice_Allocs(t *testing.T) {
+	data := make([]int, 1<<16)
+	less := func(i, j int) bool { return data[i] < data[j] }
+	allocs := testing.AllocsPerRun(10, func() {
+		for i := range data {
+			data[i] = len(data) - i
+		}
+		Slice(data, less)
+	})
+
+	if allocs > 10 {
+		t.Fatalf("sorting should not allocate for each element, but got %v allocations", allocs)
+	}
+
+	if !sort.IntsAreSorted(data) {
+		t.Fatalf("ints are not sorted")
+	}
+}
+
+func TestInts_Allocs(t *testing.T) {
+	data := make([]int, 10000)
+	allocs := testing.AllocsPerRun(10, func() {
+		for i := range data {
+			data[i] = len(data) - i
+		}
+		Ints(data)
+	})
+
+	if allocs > 10 {
+		t.Fatalf("sorting should not allocate for each element, but got %v allocations", allocs)
+	}
+}
+
+func BenchmarkSlice(b *testing.B) {
+	benchmarkSort(b, func(data Interface) {
+		x := data.(IntSlice)
+		Slice(x, func(i, j int) bool { return x[i] < x[j] })
+	})
+}
+
+func BenchmarkInts(b *testing.B) {
+	benchmarkSort(b, func(data Interface) {
+		Ints(data.(IntSlice))
+	})
+}
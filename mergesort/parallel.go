@@ -0,0 +1,89 @@
+package mergesort
+
+import (
+	"runtime"
+	"sync"
+)
+
+const (
+	// defaultParallelThreshold is the default minimum length of a subrange to be sorted concurrently.
+	defaultParallelThreshold = 1 << 12
+
+	// insertionSortThreshold is the maximum length of a subrange to be sorted by insertion sort.
+	insertionSortThreshold = 12
+)
+
+// ParallelSort sorts data like Sort, but subranges longer than threshold are
+// sorted concurrently. The number of goroutines sorting at the same time is
+// bounded by GOMAXPROCS, and short subranges are sorted by insertion sort.
+//
+// threshold <= 0 uses a default threshold of 4096 elements. Concurrent subranges
+// never overlap, so data only needs to be safe for accessing different indexes
+// concurrently, which is true for slices.
+func ParallelSort(data Interface, threshold int) {
+	if threshold <= 0 {
+		threshold = defaultParallelThreshold
+	}
+
+	n := data.Len()
+	ps := &parallelSorter{
+		data:      data,
+		threshold: threshold,
+		sem:       make(chan struct{}, runtime.GOMAXPROCS(0)),
+	}
+	ps.sort(0, n-1, make([]interface{}, n))
+}
+
+type parallelSorter struct {
+	data      Interface
+	threshold int
+	sem       chan struct{} // limits the number of extra goroutines
+}
+
+// sort sorts data[start:end+1], temp must have the same length as the subrange.
+func (ps *parallelSorter) sort(start, end int, temp []interface{}) {
+	if end-start+1 <= insertionSortThreshold {
+		insertionSort(ps.data, start, end)
+		return
+	}
+
+	mid := (start + end) / 2
+	left, right := temp[:mid-start+1], temp[mid-start+1:]
+
+	if end-start+1 < ps.threshold {
+		ps.sort(start, mid, left)
+		ps.sort(mid+1, end, right)
+		doMerge(ps.data, start, mid, end, temp)
+		return
+	}
+
+	select {
+	case ps.sem <- struct{}{}:
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-ps.sem
+				wg.Done()
+			}()
+			ps.sort(start, mid, left)
+		}()
+		ps.sort(mid+1, end, right)
+		wg.Wait()
+	default:
+		// all workers are busy, sort in current goroutine.
+		ps.sort(start, mid, left)
+		ps.sort(mid+1, end, right)
+	}
+
+	doMerge(ps.data, start, mid, end, temp)
+}
+
+// insertionSort sorts data[start:end+1] by insertion sort, it keeps the order of equal elements.
+func insertionSort(data Interface, start, end int) {
+	for i := start + 1; i <= end; i++ {
+		for j := i; j > start && data.Less(j, j-1); j-- {
+			data.Swap(j, j-1)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package mergesort
+
+import (
+	"reflect"
+)
+
+// Slice sorts the slice x given the provided less function, it panics if x is not a slice.
+//
+// Unlike Sort, elements are never boxed into interface{}: they are swapped by
+// reflect.Swapper and merged through a buffer of the same slice type, so sorting
+// doesn't allocate for each element. The sort is stable.
+//
+// less reports whether the element with index i should sort before the element with index j.
+func Slice(x interface{}, less func(i, j int) bool) {
+	rv := reflect.ValueOf(x)
+	n := rv.Len()
+	if n < 2 {
+		return
+	}
+
+	ss := &sliceSorter{
+		data: rv,
+		temp: reflect.MakeSlice(rv.Type(), n, n),
+		swap: reflect.Swapper(x),
+		less: less,
+	}
+	sortBlocks(ss, n)
+}
+
+// Ints sorts a slice of ints in increasing order. The sort is stable.
+func Ints(x []int) {
+	if len(x) < 2 {
+		return
+	}
+	sortBlocks(&intSorter{data: x, temp: make([]int, len(x))}, len(x))
+}
+
+// Float64s sorts a slice of float64s in increasing order, not-a-number values are ordered before other values.
+// The sort is stable.
+func Float64s(x []float64) {
+	if len(x) < 2 {
+		return
+	}
+	sortBlocks(&float64Sorter{data: x, temp: make([]float64, len(x))}, len(x))
+}
+
+// Strings sorts a slice of strings in increasing order. The sort is stable.
+func Strings(x []string) {
+	if len(x) < 2 {
+		return
+	}
+	sortBlocks(&stringSorter{data: x, temp: make([]string, len(x))}, len(x))
+}
+
+// MultiKey returns a less function that compares elements by the given less functions
+// in order, a later one is used only if elements are equal by all the former ones.
+// It is useful for sorting by multiple keys, for example:
+//
+//	mergesort.Slice(people, mergesort.MultiKey(
+//		func(i, j int) bool { return people[i].Age < people[j].Age },
+//		func(i, j int) bool { return people[i].Name < people[j].Name },
+//	))
+func MultiKey(lesses ...func(i, j int) bool) func(i, j int) bool {
+	return func(i, j int) bool {
+		for _, less := range lesses {
+			if less(i, j) {
+				return true
+			}
+			if less(j, i) {
+				return false
+			}
+		}
+		return false
+	}
+}
+
+// blockSorter sorts the blocks of a slice, and merges the sorted ones.
+type blockSorter interface {
+	// insertionSort sorts data[lo:hi] by insertion sort.
+	insertionSort(lo, hi int)
+	// merge merges the sorted data[lo:mid] and data[mid:hi].
+	merge(lo, mid, hi int)
+}
+
+// sortBlocks sorts blocks of insertionSortThreshold elements by insertion sort, and then
+// merges the sorted blocks bottom-up.
+func sortBlocks(s blockSorter, n int) {
+	for lo := 0; lo < n; lo += insertionSortThreshold {
+		hi := lo + insertionSortThreshold
+		if hi > n {
+			hi = n
+		}
+		s.insertionSort(lo, hi)
+	}
+
+	for width := insertionSortThreshold; width < n; width *= 2 {
+		for lo := 0; lo+width < n; lo += 2 * width {
+			hi := lo + 2*width
+			if hi > n {
+				hi = n
+			}
+			s.merge(lo, lo+width, hi)
+		}
+	}
+}
+
+type intSorter struct {
+	data []int
+	temp []int
+}
+
+func (s *intSorter) insertionSort(lo, hi int) {
+	data := s.data
+	for i := lo + 1; i < hi; i++ {
+		for j := i; j > lo && data[j] < data[j-1]; j-- {
+			data[j], data[j-1] = data[j-1], data[j]
+		}
+	}
+}
+
+func (s *intSorter) merge(lo, mid, hi int) {
+	data, temp := s.data, s.temp
+	if !(data[mid] < data[mid-1]) {
+		// in order already
+		return
+	}
+
+	i, j, k := lo, mid, 0
+	for i < mid && j < hi {
+		// taking the element from left run if they are equal keeps the sort stable.
+		if data[j] < data[i] {
+			temp[k] = data[j]
+			j++
+		} else {
+			temp[k] = data[i]
+			i++
+		}
+		k++
+	}
+	k += copy(temp[k:], data[i:mid])
+
+	// the rest of right run is in place already.
+	copy(data[lo:], temp[:k])
+}
+
+type float64Sorter struct {
+	data []float64
+	temp []float64
+}
+
+func float64Less(a, b float64) bool {
+	return a < b || (isNaN(a) && !isNaN(b))
+}
+
+func (s *float64Sorter) insertionSort(lo, hi int) {
+	data := s.data
+	for i := lo + 1; i < hi; i++ {
+		for j := i; j > lo && float64Less(data[j], data[j-1]); j-- {
+			data[j], data[j-1] = data[j-1], data[j]
+		}
+	}
+}
+
+func (s *float64Sorter) merge(lo, mid, hi int) {
+	data, temp := s.data, s.temp
+	if !float64Less(data[mid], data[mid-1]) {
+		// in order already
+		return
+	}
+
+	i, j, k := lo, mid, 0
+	for i < mid && j < hi {
+		// taking the element from left run if they are equal keeps the sort stable.
+		if float64Less(data[j], data[i]) {
+			temp[k] = data[j]
+			j++
+		} else {
+			temp[k] = data[i]
+			i++
+		}
+		k++
+	}
+	k += copy(temp[k:], data[i:mid])
+
+	// the rest of right run is in place already.
+	copy(data[lo:], temp[:k])
+}
+
+type stringSorter struct {
+	data []string
+	temp []string
+}
+
+func (s *stringSorter) insertionSort(lo, hi int) {
+	data := s.data
+	for i := lo + 1; i < hi; i++ {
+		for j := i; j > lo && data[j] < data[j-1]; j-- {
+			data[j], data[j-1] = data[j-1], data[j]
+		}
+	}
+}
+
+func (s *stringSorter) merge(lo, mid, hi int) {
+	data, temp := s.data, s.temp
+	if !(data[mid] < data[mid-1]) {
+		// in order already
+		return
+	}
+
+	i, j, k := lo, mid, 0
+	for i < mid && j < hi {
+		// taking the element from left run if they are equal keeps the sort stable.
+		if data[j] < data[i] {
+			temp[k] = data[j]
+			j++
+		} else {
+			temp[k] = data[i]
+			i++
+		}
+		k++
+	}
+	k += copy(temp[k:], data[i:mid])
+
+	// the rest of right run is in place already.
+	copy(data[lo:], temp[:k])
+}
+
+type sliceSorter struct {
+	data reflect.Value
+	temp reflect.Value
+	swap func(i, j int)
+	less func(i, j int) bool
+}
+
+func (ss *sliceSorter) insertionSort(lo, hi int) {
+	for i := lo + 1; i < hi; i++ {
+		for j := i; j > lo && ss.less(j, j-1); j-- {
+			ss.swap(j, j-1)
+		}
+	}
+}
+
+// merge merges data[lo:mid] and data[mid:hi] through temp. Elements are copied by
+// reflect.Value.Set, which doesn't allocate, unlike reflect.Value.Slice.
+func (ss *sliceSorter) merge(lo, mid, hi int) {
+	if !ss.less(mid, mid-1) {
+		// in order already
+		return
+	}
+
+	data, temp := ss.data, ss.temp
+	i, j, k := lo, mid, 0
+	for i < mid && j < hi {
+		// taking the element from left run if they are equal keeps the sort stable.
+		if ss.less(j, i) {
+			temp.Index(k).Set(data.Index(j))
+			j++
+		} else {
+			temp.Index(k).Set(data.Index(i))
+			i++
+		}
+		k++
+	}
+
+	for ; i < mid; i++ {
+		temp.Index(k).Set(data.Index(i))
+		k++
+	}
+
+	// the rest of right run is in place already.
+	for x := 0; x < k; x++ {
+		data.Index(lo + x).Set(temp.Index(x))
+	}
+}
@@ -0,0 +1,87 @@
+package metric
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var circuitBreakerCollectorMux sync.Mutex
+var circuitBreakerCollectors = map[string]*CircuitBreakerCollector{}
+
+// CircuitBreakerCollector collects the states of circuit breakers, such as the ones
+// of convhttp.Client.
+type CircuitBreakerCollector struct {
+	state       *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+	rejected    *prometheus.CounterVec
+}
+
+// GetOrRegisterCircuitBreakerCollector returns the circuit breaker collector of current
+// namespace, the collector is registered on first call.
+func GetOrRegisterCircuitBreakerCollector() *CircuitBreakerCollector {
+	circuitBreakerCollectorMux.Lock()
+	defer circuitBreakerCollectorMux.Unlock()
+
+	if c, ok := circuitBreakerCollectors[metricNamespace]; ok && c != nil {
+		return c
+	}
+
+	state := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Subsystem: "circuit_breaker",
+			Name:      "state",
+			Help:      "Circuit breaker state, 1 for the current state and 0 for the others",
+		},
+		[]string{"client", "host", "state"},
+	)
+
+	transitions := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Subsystem: "circuit_breaker",
+			Name:      "transitions_total",
+			Help:      "Circuit breaker state transitions total",
+		},
+		[]string{"client", "host", "from", "to"},
+	)
+
+	rejected := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Subsystem: "circuit_breaker",
+			Name:      "rejected_total",
+			Help:      "Requests rejected by open circuit breaker total",
+		},
+		[]string{"client", "host"},
+	)
+
+	defaultRegister.MustRegister(state, transitions, rejected)
+
+	c := &CircuitBreakerCollector{
+		state:       state,
+		transitions: transitions,
+		rejected:    rejected,
+	}
+
+	circuitBreakerCollectors[metricNamespace] = c
+	return c
+}
+
+// ObserveStateChange records the state transition of the circuit breaker of host.
+func (c *CircuitBreakerCollector) ObserveStateChange(client string, host string, from string, to string) {
+	c.state.WithLabelValues(client, host, from).Set(0)
+	c.state.WithLabelValues(client, host, to).Set(1)
+	c.transitions.WithLabelValues(client, host, from, to).Inc()
+}
+
+// ObserveRejected records a request rejected by the circuit breaker of host.
+func (c *CircuitBreakerCollector) ObserveRejected(client string, host string) {
+	c.rejected.WithLabelValues(client, host).Inc()
+}
+
+// ObserveState records the initial state of the circuit breaker of host.
+func (c *CircuitBreakerCollector) ObserveState(client string, host string, state string) {
+	c.state.WithLabelValues(client, host, state).Set(1)
+}